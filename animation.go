@@ -0,0 +1,689 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * animation.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// How long each frame of an animation is shown for.
+const frameInterval = 20 * time.Millisecond
+
+// An AnimationOption tweaks how an animation runs. Without any, animations run exactly
+// as described.
+type AnimationOption func(*animationOptions)
+
+// The settings gathered from a list of AnimationOptions.
+type animationOptions struct {
+	jitter      float64
+	strictFrame bool
+	peakDecay   float64 // In LEDs per second.
+	space       ColorSpace
+}
+
+// Jitter randomly varies an animation's timing and brightness by up to the given fraction
+// either way, so Jitter(0.2) makes each pulse up to 20% longer or shorter and brighter or
+// dimmer than the last. A little goes a long way toward making candle and fire effects
+// look natural. The randomness comes from the stick's SetRand source.
+func Jitter(amount float64) AnimationOption {
+	return func(o *animationOptions) {
+		o.jitter = math.Max(0, math.Min(1, amount))
+	}
+}
+
+// StrictFrames makes PlayStream fail on a short final frame rather than pad it out with
+// black.
+func StrictFrames() AnimationOption {
+	return func(o *animationOptions) {
+		o.strictFrame = true
+	}
+}
+
+// PeakDecay sets how quickly VUMeter's peak indicator falls back, in LEDs per second.
+// The default is 10.
+func PeakDecay(ledsPerSecond float64) AnimationOption {
+	return func(o *animationOptions) {
+		o.peakDecay = math.Max(0, ledsPerSecond)
+	}
+}
+
+// Gathers up a list of options.
+func gatherOptions(opts []AnimationOption) animationOptions {
+	var o animationOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Randomly scales x by up to the jitter either way.
+func (o animationOptions) vary(stk *BlinkStick, x float64) float64 {
+	if o.jitter == 0 {
+		return x
+	}
+	return x * (1 + o.jitter*(2*stk.randFloat64()-1))
+}
+
+// Randomly stretches or squeezes a duration by up to the jitter.
+func (o animationOptions) varyDuration(stk *BlinkStick, d time.Duration) time.Duration {
+	return time.Duration(o.vary(stk, float64(d)))
+}
+
+// Morph fades one LED from whatever it's showing now to a new color over duration.
+// The fade is worked out in RGB unless InColorSpace says otherwise.
+//
+// The fade starts from the color last asked for, going by LastFrame. Only if there isn't
+// one is the LED read back, and then it starts from the corrected color the device holds.
+// If ctx is cancelled partway through, the LED is left where the fade got to.
+func (stk *BlinkStick) Morph(ctx context.Context, channel, index byte, c Color, duration time.Duration, opts ...AnimationOption) error {
+	o := gatherOptions(opts)
+	from, err := stk.lastColor(channel, index)
+	if err != nil {
+		return err
+	}
+
+	steps := int(duration / frameInterval)
+	if steps < 1 {
+		steps = 1
+	}
+
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for step := 1; step <= steps; step++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		mid := MixColorsIn(o.space, from, c, float64(step)/float64(steps))
+		err := stk.SetRGB(channel, index, mid.R, mid.G, mid.B)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the color an LED was last asked to be, reading it back from the device if the
+// mirror doesn't have it.
+func (stk *BlinkStick) lastColor(channel, index byte) (Color, error) {
+	frame, ok := stk.LastFrame(channel)
+	if ok && int(index) < len(frame.Pixels) {
+		return frame.Pixels[index], nil
+	}
+
+	data, err := stk.GetChannelLEDData(channel, int(index)+1)
+	if err != nil {
+		return Color{}, err
+	}
+	return stk.decodeColor(channel, data[int(index)*3:]), nil
+}
+
+// MorphToName fades one LED to a named color, as listed in Colors.
+func (stk *BlinkStick) MorphToName(ctx context.Context, channel, index byte, name string, duration time.Duration) error {
+	c, ok := ColorByName(name)
+	if !ok {
+		return fmt.Errorf("unknown color %q", name)
+	}
+	return stk.Morph(ctx, channel, index, c, duration)
+}
+
+// Pulse fades every LED on a channel up to a color and back down to black, once per
+// period, until ctx is done.
+func (stk *BlinkStick) Pulse(ctx context.Context, channel byte, c Color, period time.Duration, opts ...AnimationOption) error {
+	return stk.pulse(ctx, channel, c, period, 0, gatherOptions(opts))
+}
+
+// PulseFor pulses every LED on a channel like Pulse for the total duration given, then
+// turns them off.
+func (stk *BlinkStick) PulseFor(channel byte, c Color, period, total time.Duration, opts ...AnimationOption) error {
+	err := RunFor(total, func(ctx context.Context) error {
+		return stk.Pulse(ctx, channel, c, period, opts...)
+	})
+	if err != nil {
+		return err
+	}
+	return stk.Off(channel)
+}
+
+// BlinkFor blinks every LED on a channel like Blink for the total duration given.
+func (stk *BlinkStick) BlinkFor(channel byte, c Color, interval, total time.Duration, opts ...AnimationOption) error {
+	return RunFor(total, func(ctx context.Context) error {
+		return stk.Blink(ctx, channel, c, interval, opts...)
+	})
+}
+
+// RunFor runs an animation with a context that's done after d, for when all a caller
+// wants is to play something for a while. Running out of time isn't an error.
+func RunFor(d time.Duration, anim func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	err := anim(ctx)
+	if err == context.DeadlineExceeded {
+		return nil
+	}
+	return err
+}
+
+// An AnimationHandle keeps track of an animation started with RunAsync.
+type AnimationHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// RunAsync starts an animation in its own goroutine and returns straight away, for firing
+// off an animation and waiting on it later. The animation stops when ctx is done, the
+// handle is cancelled, or the stick is put to Sleep.
+func (stk *BlinkStick) RunAsync(ctx context.Context, anim func(ctx context.Context) error) *AnimationHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &AnimationHandle{cancel: cancel, done: make(chan struct{})}
+
+	table := &stk.shared().running
+	table.mu.Lock()
+	if table.handles == nil {
+		table.handles = map[*AnimationHandle]struct{}{}
+	}
+	table.handles[h] = struct{}{}
+	table.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		h.err = anim(ctx)
+
+		table.mu.Lock()
+		delete(table.handles, h)
+		table.mu.Unlock()
+		close(h.done)
+	}()
+	return h
+}
+
+// Done returns a channel that's closed once the animation has finished.
+func (h *AnimationHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns what the animation returned, once it's finished. Until then it's nil.
+func (h *AnimationHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Cancel stops the animation. It doesn't wait for it to finish; use Done for that.
+func (h *AnimationHandle) Cancel() {
+	h.cancel()
+}
+
+// Wait blocks until the animation has finished and returns its error.
+func (h *AnimationHandle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Notify flashes an alert without disturbing whatever the channel was showing.
+//
+// The channel is snapshotted, pulsed with c the given number of times (a second each,
+// and it must be at least one), and then restored. The restore happens even if ctx is
+// cancelled partway through, in which case ctx's error is returned.
+func (stk *BlinkStick) Notify(ctx context.Context, channel byte, c Color, pulses int) error {
+	if pulses <= 0 {
+		return fmt.Errorf("notify pulse count must be positive, got %d", pulses)
+	}
+
+	snap, err := stk.Snapshot(channel)
+	if err != nil {
+		return err
+	}
+
+	err = stk.pulse(ctx, channel, c, time.Second, pulses, animationOptions{})
+	restoreErr := stk.Restore(snap)
+	if err != nil {
+		return err
+	}
+	return restoreErr
+}
+
+// Pulses a channel the given number of times, or until ctx is done if times isn't positive.
+func (stk *BlinkStick) pulse(ctx context.Context, channel byte, c Color, period time.Duration, times int, o animationOptions) error {
+	count := stk.GetLEDCount()
+	cycle, start := 0, time.Now()
+	cyclePeriod, peak := o.varyDuration(stk, period), o.vary(stk, 1)
+
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			phase := float64(now.Sub(start)) / float64(cyclePeriod)
+			if phase >= 1 {
+				cycle++
+				if times > 0 && cycle >= times {
+					return stk.SetAllRGBN(channel, count, 0, 0, 0)
+				}
+				start, phase = start.Add(cyclePeriod), phase-1
+				cyclePeriod, peak = o.varyDuration(stk, period), o.vary(stk, 1)
+			}
+
+			level := c.Scale(peak * (1 - math.Cos(2*math.Pi*phase)) / 2)
+			err := stk.SetAllRGBN(channel, count, level.R, level.G, level.B)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PulseBetween breathes one LED back and forth between two colors, starting at a and
+// reaching b halfway through each period, until ctx is done.
+func (stk *BlinkStick) PulseBetween(ctx context.Context, channel, index byte, a, b Color, period time.Duration) error {
+	start := time.Now()
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			phase := float64(now.Sub(start)) / float64(period)
+			c := MixColors(a, b, (1-math.Cos(2*math.Pi*phase))/2)
+			err := stk.SetRGB(channel, index, c.R, c.G, c.B)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PulseBrightness breathes one LED between two values of the same hue and saturation,
+// starting at minV and reaching maxV halfway through each period, until ctx is done.
+// Unlike Pulse, which fades toward black, the color itself never shifts, only how
+// bright it is. The values are clamped to between 0 and 1.
+func (stk *BlinkStick) PulseBrightness(ctx context.Context, channel, index byte, hue, sat float64, minV, maxV float64, period time.Duration) error {
+	minV = math.Max(0, math.Min(1, minV))
+	maxV = math.Max(0, math.Min(1, maxV))
+
+	start := time.Now()
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			phase := float64(now.Sub(start)) / float64(period)
+			v := minV + (maxV-minV)*(1-math.Cos(2*math.Pi*phase))/2
+			err := stk.SetHSV(channel, index, hue, sat, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Blink flashes every LED on a channel on and off, holding each for interval, until
+// ctx is done. The LEDs are left off.
+func (stk *BlinkStick) Blink(ctx context.Context, channel byte, c Color, interval time.Duration, opts ...AnimationOption) error {
+	return stk.SignalPattern(ctx, channel, c, []time.Duration{interval, interval}, opts...)
+}
+
+// SignalPattern flashes a channel in a pattern until ctx is done, leaving the LEDs off.
+//
+// The pattern alternates between on and off, starting with on, holding each for the
+// listed duration before looping around. SOS, for example, is three short, three long,
+// and three short flashes followed by a longer pause. A pattern with an odd length swaps
+// which durations are on and off each time around.
+func (stk *BlinkStick) SignalPattern(ctx context.Context, channel byte, c Color, pattern []time.Duration, opts ...AnimationOption) error {
+	if len(pattern) == 0 {
+		return fmt.Errorf("empty signal pattern")
+	}
+
+	o := gatherOptions(opts)
+	hold := func(d time.Duration) time.Duration { return o.varyDuration(stk, d) }
+
+	count := stk.GetLEDCount()
+	err := alternate(ctx, pattern, hold, func(on bool) error {
+		if on {
+			level := c.Scale(o.vary(stk, 1))
+			return stk.SetAllRGBN(channel, count, level.R, level.G, level.B)
+		}
+		return stk.SetAllRGBN(channel, count, 0, 0, 0)
+	})
+	if err != ctx.Err() {
+		return err
+	}
+	if err := stk.SetAllRGBN(channel, count, 0, 0, 0); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// A SequenceStep is one color in a Sequence, and how long it's held.
+type SequenceStep struct {
+	Color Color
+	Hold  time.Duration
+}
+
+// Sequence shows a series of colors on every LED of a channel, like a traffic light,
+// switching straight from one to the next with no fading.
+//
+// With loop set, it goes around until ctx is done. Otherwise it stops after the last
+// step's hold, leaving its color showing.
+func (stk *BlinkStick) Sequence(ctx context.Context, channel byte, steps []SequenceStep, loop bool) error {
+	if len(steps) == 0 {
+		return nil
+	}
+
+	count := stk.GetLEDCount()
+	for {
+		for _, step := range steps {
+			err := stk.SetAllRGBN(channel, count, step.Color.R, step.Color.G, step.Color.B)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Hold):
+			}
+		}
+		if !loop {
+			return nil
+		}
+	}
+}
+
+// Toggles set between on and off, holding each for the next duration in pattern as
+// adjusted by hold, and loops until ctx is done.
+func alternate(ctx context.Context, pattern []time.Duration, hold func(time.Duration) time.Duration, set func(on bool) error) error {
+	on := true
+	for i := 0; ; i = (i + 1) % len(pattern) {
+		err := set(on)
+		if err != nil {
+			return err
+		}
+		on = !on
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hold(pattern[i])):
+		}
+	}
+}
+
+// PaletteCycle colors each LED from a palette by index, then rotates the palette one step
+// along every speed until ctx is done, the classic plasma trick.
+//
+// LED i shows palette[(indices[i]+offset) % len(palette)], with offset counting up each
+// step. There can't be more indices than the channel has LEDs.
+func (stk *BlinkStick) PaletteCycle(ctx context.Context, channel byte, palette []Color, indices []int, speed time.Duration) error {
+	if len(palette) == 0 {
+		return fmt.Errorf("empty palette")
+	}
+	if speed <= 0 {
+		return fmt.Errorf("palette cycle speed must be positive, got %v", speed)
+	}
+	if count := stk.GetLEDCount(); count >= 0 && len(indices) > count {
+		return fmt.Errorf("%d indices given, but the device only has %d LEDs", len(indices), count)
+	}
+
+	pixels := make([]Color, len(indices))
+	ticker := time.NewTicker(speed)
+	defer ticker.Stop()
+	for offset := 0; ; offset = (offset + 1) % len(palette) {
+		for i, index := range indices {
+			n := (index + offset) % len(palette)
+			if n < 0 {
+				n += len(palette)
+			}
+			pixels[i] = palette[n]
+		}
+
+		err := stk.writeFrame(channel, pixels)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns palette indices that spread a palette of size colors evenly over count LEDs, for
+// PaletteCycle.
+func spreadPalette(count, size int) []int {
+	indices := make([]int, count)
+	for i := range indices {
+		indices[i] = i * size / count
+	}
+	return indices
+}
+
+// Returns the 60 colors of a full turn around the hue wheel, starting from hue.
+func hueWheel(hue float64) []Color {
+	palette := make([]Color, 60)
+	for i := range palette {
+		palette[i] = FromHSV(hue+float64(i)*6, 1, 1)
+	}
+	return palette
+}
+
+// Flicker makes a channel waver like a candle flame around a warm base color until ctx
+// is done.
+//
+// Every LED's brightness is randomly dipped, and its hue nudged toward a deeper red,
+// by an amount scaled by intensity, from 0 (steady) to 1 (guttering). Frames come at
+// jittered intervals too, so it never settles into a rhythm.
+func (stk *BlinkStick) Flicker(ctx context.Context, channel byte, base Color, intensity float64) error {
+	intensity = math.Max(0, math.Min(1, intensity))
+	ember := Color{R: base.R, G: base.G / 2, B: base.B / 4}
+	o := animationOptions{jitter: intensity}
+
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+	frame := NewFrame(count)
+
+	for {
+		for i := range frame.Pixels {
+			flame := base.Lerp(ember, intensity*stk.randFloat64())
+			frame.Pixels[i] = flame.Scale(1 - intensity*stk.randFloat64()/2)
+		}
+
+		err := stk.Flush(channel, frame)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.varyDuration(stk, 3*frameInterval)):
+		}
+	}
+}
+
+// Meter shows a changing value as a color until ctx is done, like a CPU load light.
+//
+// Every interval, sample is called for a value from 0 to 1, which is clamped, and every
+// LED on the channel is set to that point on the gradient from lo to hi.
+func (stk *BlinkStick) Meter(ctx context.Context, channel byte, sample func() float64, lo, hi Color, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("meter interval must be positive, got %v", interval)
+	}
+	count := stk.GetLEDCount()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c := lo.Lerp(hi, sample())
+		err := stk.SetAllRGBN(channel, count, c.R, c.G, c.B)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// The rate VUMeter's peak falls at unless PeakDecay says otherwise, in LEDs per second.
+const defaultPeakDecay = 10
+
+// VUMeter lights a channel like a VU meter until ctx is done or levels is closed.
+//
+// Each level received, from 0 to 1, lights that fraction of the LEDs from the start of the
+// strip in baseColor, rounding up. Above them, one LED in peakColor marks the highest
+// level lately, falling back at the rate set with PeakDecay. Frames are drawn at the
+// usual animation rate however fast levels come in, using the latest one.
+func (stk *BlinkStick) VUMeter(ctx context.Context, channel byte, levels <-chan float64, peakColor, baseColor Color, opts ...AnimationOption) error {
+	o := animationOptions{peakDecay: defaultPeakDecay}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+
+	var lit int
+	var peak float64
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case level, ok := <-levels:
+			if !ok {
+				return nil
+			}
+			lit = int(math.Ceil(math.Max(0, math.Min(1, level)) * float64(count)))
+			peak = math.Max(peak, float64(lit))
+			continue
+		case <-ticker.C:
+		}
+
+		peakLED := int(math.Ceil(peak)) - 1
+		err := stk.Fill(channel, func(i int) Color {
+			switch {
+			case i < lit:
+				return baseColor
+			case i == peakLED:
+				return peakColor
+			}
+			return Color{}
+		})
+		if err != nil {
+			return err
+		}
+		peak = math.Max(float64(lit), peak-o.peakDecay*frameInterval.Seconds())
+	}
+}
+
+// PartyMode shows off, cycling through the registered "rainbow", "pulse", "chase", and
+// "twinkle" effects, each for dwell, until ctx is done. Registering replacements for any
+// of them changes the show. Colors are picked at random from the stick's random source,
+// so SetRand makes it repeatable.
+func (stk *BlinkStick) PartyMode(ctx context.Context, channel byte, dwell time.Duration) error {
+	party := *stk
+	party.SetDefaultChannel(channel)
+	randomHue := func() Color {
+		return FromHSV(360*stk.randFloat64(), 1, 1)
+	}
+
+	steps := []struct {
+		name   string
+		params func() map[string]any
+	}{
+		{"rainbow", func() map[string]any { return map[string]any{"hue": 360 * stk.randFloat64()} }},
+		{"pulse", func() map[string]any { return map[string]any{"color": randomHue()} }},
+		{"chase", func() map[string]any { return map[string]any{"color": randomHue()} }},
+		{"twinkle", func() map[string]any { return nil }},
+	}
+
+	for i := 0; ; i = (i + 1) % len(steps) {
+		effectCtx, cancel := context.WithTimeout(ctx, dwell)
+		err := party.RunNamed(effectCtx, steps[i].name, steps[i].params())
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && err != context.DeadlineExceeded {
+			return err
+		}
+	}
+}
+
+// Sends a lit LED with a fading tail behind it round and round a channel, moving one LED
+// every interval, until ctx is done.
+func (stk *BlinkStick) chase(ctx context.Context, channel byte, count int, head Color, interval time.Duration) error {
+	frame := NewFrame(count)
+	for i := 0; i < 4 && i < count; i++ {
+		frame.Pixels[(count-i)%count] = head.Scale(1 / float64(i+1))
+	}
+	err := stk.Flush(channel, frame)
+	if err != nil {
+		return err
+	}
+	return stk.Scroll(ctx, channel, 1, interval)
+}
+
+// Lights random LEDs in random colors and lets them fade away, until ctx is done.
+func (stk *BlinkStick) twinkle(ctx context.Context, channel byte, count int, randomHue func() Color) error {
+	if count <= 0 {
+		return fmt.Errorf("no LEDs to twinkle")
+	}
+	if count > 256 {
+		count = 256
+	}
+
+	ticker := time.NewTicker(2 * frameInterval)
+	defer ticker.Stop()
+	for {
+		err := stk.Decay(channel, Color{}, 0.15)
+		if err != nil {
+			return err
+		}
+		if stk.randFloat64() < 0.3 {
+			c := randomHue()
+			err := stk.SetRGB(channel, byte(stk.randUint32()%uint32(count)), c.R, c.G, c.B)
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,433 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * animation_test.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/different55/blinkstickgo/testdevice"
+)
+
+func TestRunAsync(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	h := stk.RunAsync(context.Background(), func(ctx context.Context) error {
+		return stk.Pulse(ctx, 0, Color{255, 0, 0}, 100*time.Millisecond)
+	})
+	if err := h.Err(); err != nil {
+		t.Errorf("Err before finishing = %v, want nil", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	h.Cancel()
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("animation didn't stop after Cancel")
+	}
+	if err := h.Wait(); err != context.Canceled {
+		t.Errorf("Pulse returned %v after Cancel, want %v", err, context.Canceled)
+	}
+	if len(device.Writes()) == 0 {
+		t.Error("Pulse didn't write anything")
+	}
+
+	h = stk.RunAsync(context.Background(), func(ctx context.Context) error {
+		return stk.Morph(ctx, 0, 0, Color{0, 0, 255}, time.Hour)
+	})
+	h.Cancel()
+	if err := h.Wait(); err != context.Canceled {
+		t.Errorf("cancelled Morph returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMorphFromLastFrame(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetBrightness(0.5)
+	if err := stk.SetAllRGB(0, 200, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.SetRGB(0, 0, 200, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := device.Writes()[1].Data
+	device.Reset()
+
+	// Fading to the color it's already showing shouldn't change anything along the way.
+	if err := stk.Morph(context.Background(), 0, 0, Color{200, 0, 0}, 3*frameInterval); err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range device.Writes() {
+		if !reflect.DeepEqual(write.Data, want) {
+			t.Errorf("Morph to the same color wrote %v, want %v", write.Data, want)
+		}
+	}
+}
+
+func TestPlayStream(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.RGB = true
+
+	stream := strings.NewReader("\x01\x02\x03\x04\x05\x06\x07\x08")
+	err := stk.PlayStream(context.Background(), 0, stream, 6, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writes := device.Writes()
+	if len(writes) != 2 {
+		t.Fatalf("PlayStream made writes %v, want two frames", writes)
+	}
+	if data := writes[1].Data[2:8]; string(data) != "\x07\x08\x00\x00\x00\x00" {
+		t.Errorf("PlayStream wrote a short frame as %v, want it padded with black", data)
+	}
+
+	stream = strings.NewReader("\x01\x02\x03\x04")
+	err = stk.PlayStream(context.Background(), 0, stream, 3, 1000, StrictFrames())
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("PlayStream with StrictFrames = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	red, yellow, green := Color{255, 0, 0}, Color{255, 255, 0}, Color{0, 255, 0}
+	steps := []SequenceStep{{red, time.Millisecond}, {yellow, time.Millisecond}, {green, time.Millisecond}}
+	if err := stk.Sequence(context.Background(), 0, steps, false); err != nil {
+		t.Fatal(err)
+	}
+	if writes := device.Writes(); len(writes) != 3 {
+		t.Errorf("Sequence made writes %v, want one per step", writes)
+	}
+	if frame, _ := stk.LastFrame(0); frame.Pixels[0] != green {
+		t.Errorf("Sequence left %v showing, want the last step's %v", frame.Pixels[0], green)
+	}
+
+	if err := stk.Sequence(context.Background(), 0, nil, true); err != nil {
+		t.Errorf("Sequence with no steps = %v, want nil", err)
+	}
+}
+
+func TestPartyMode(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetRand(rand.New(rand.NewSource(1)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := stk.PartyMode(ctx, 0, 100*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("PartyMode returned %v when ctx ended, want %v", err, context.DeadlineExceeded)
+	}
+	if len(device.Writes()) < 10 {
+		t.Errorf("PartyMode made only %d writes in half a second", len(device.Writes()))
+	}
+}
+
+func TestFlashFor(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	red, blue := Color{255, 0, 0}, Color{0, 0, 255}
+	if err := stk.SetAllRGB(0, 0, 255, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stk.FlashFor(0, 1, red, 30*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := stk.FlashFor(0, 1, blue, 60*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if frame, _ := stk.LastFrame(0); frame.Pixels[1] != blue {
+		t.Errorf("LED %v after the first flash ended, want the second flash still showing", frame.Pixels[1])
+	}
+	time.Sleep(60 * time.Millisecond)
+	if frame, _ := stk.LastFrame(0); frame.Pixels[1] != (Color{0, 255, 0}) {
+		t.Errorf("LED %v after both flashes ended, want it back to green", frame.Pixels[1])
+	}
+}
+
+func TestFlashForFromErrorHook(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if err := stk.SetAllRGB(0, 0, 255, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flash an error color from the hook, once, as the hook's made for.
+	var flashed bool
+	stk.OnControlError(func(err error) {
+		if !flashed {
+			flashed = true
+			stk.FlashFor(0, 0, Color{255, 0, 0}, time.Millisecond)
+		}
+	})
+	device.SetError(errors.New("unplugged"))
+
+	done := make(chan error)
+	go func() { done <- stk.FlashFor(0, 1, Color{0, 0, 255}, time.Millisecond) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("FlashFor on a failing device succeeded")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("FlashFor deadlocked when the error hook flashed")
+	}
+}
+
+func TestVUMeter(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	base, peak := Color{0, 255, 0}, Color{255, 0, 0}
+
+	levels := make(chan float64)
+	done := make(chan error)
+	go func() {
+		done <- stk.VUMeter(context.Background(), 0, levels, peak, base, PeakDecay(25))
+	}()
+
+	levels <- 0.6
+	time.Sleep(3 * frameInterval)
+	frame, _ := stk.LastFrame(0)
+	if frame.Pixels[4] != base || frame.Pixels[5] != (Color{}) {
+		t.Errorf("VUMeter at 0.6 showed %v, want five LEDs lit", frame.Pixels)
+	}
+
+	levels <- 0.1
+	time.Sleep(3 * frameInterval)
+	frame, _ = stk.LastFrame(0)
+	peaks := 0
+	for _, c := range frame.Pixels[1:5] {
+		if c == peak {
+			peaks++
+		}
+	}
+	if frame.Pixels[0] != base || frame.Pixels[1] == base || peaks != 1 {
+		t.Errorf("VUMeter dropping to 0.1 showed %v, want one LED lit and the peak falling behind", frame.Pixels)
+	}
+
+	time.Sleep(10 * frameInterval)
+	frame, _ = stk.LastFrame(0)
+	if frame.Pixels[0] != base || frame.Pixels[1] != (Color{}) || frame.Pixels[2] != (Color{}) {
+		t.Errorf("VUMeter after the peak fell showed %v, want it down to the level", frame.Pixels)
+	}
+
+	close(levels)
+	if err := <-done; err != nil {
+		t.Errorf("VUMeter returned %v when levels closed, want nil", err)
+	}
+}
+
+func TestValueNoise(t *testing.T) {
+	for x := -10.0; x < 10; x += 0.37 {
+		v := valueNoise(x)
+		if v < 0 || v >= 1 {
+			t.Fatalf("valueNoise(%v) = %v, want it from 0 up to 1", x, v)
+		}
+		if d := math.Abs(valueNoise(x+0.001) - v); d > 0.01 {
+			t.Errorf("valueNoise jumps by %v at %v, want it smooth", d, x)
+		}
+	}
+	if valueNoise(3) != latticeValue(3) {
+		t.Error("valueNoise doesn't pass through the lattice values")
+	}
+}
+
+func TestPulseBrightness(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.RGB = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := stk.PulseBrightness(ctx, 0, 0, 30, 1, 0.2, 1.5, 100*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+
+	writes := device.Writes()
+	if len(writes) == 0 {
+		t.Fatal("PulseBrightness didn't write anything")
+	}
+	for _, w := range writes {
+		r, g, b := w.Data[1], w.Data[2], w.Data[3]
+		if h, s, _ := (Color{r, g, b}).ToHSV(); math.Abs(h-30) > 3 || s < 0.95 || b != 0 || r < 51 {
+			t.Errorf("PulseBrightness wrote %v, want hue 30 at no less than 0.2 value", Color{r, g, b})
+		}
+	}
+}
+
+func TestRunNamed(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*frameInterval)
+	defer cancel()
+	if err := stk.RunNamed(ctx, "solid", map[string]any{"color": "red"}); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if frame, _ := stk.LastFrame(0); frame.Pixels[7] != (Color{255, 0, 0}) {
+		t.Errorf("solid red effect showed %v", frame.Pixels)
+	}
+
+	builtIn := []string{"blink", "chase", "flicker", "noise", "palettecycle", "pulse", "rainbow", "scroll", "solid", "twinkle"}
+	for _, name := range builtIn {
+		device.Reset()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*frameInterval)
+		err := stk.RunNamed(ctx, name, nil)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("RunNamed(%q) = %v, want %v", name, err, context.DeadlineExceeded)
+		}
+		if len(device.Writes()) == 0 {
+			t.Errorf("RunNamed(%q) didn't write anything", name)
+		}
+	}
+
+	// A strip that says it has no LEDs shouldn't bring any of them down.
+	device.LEDs = 0
+	empty := NewBlinkStick(device, "BS000001-3.0")
+	for _, name := range builtIn {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*frameInterval)
+		err := empty.RunNamed(ctx, name, nil)
+		cancel()
+		if name == "twinkle" && (err == nil || err == context.DeadlineExceeded) {
+			t.Errorf("RunNamed(%q) with no LEDs = %v, want an error", name, err)
+		}
+	}
+
+	RegisterEffect("test", func(params map[string]any) (Effect, error) {
+		return EffectFunc(func(ctx context.Context, stk *BlinkStick, t time.Duration) error {
+			return io.EOF
+		}), nil
+	})
+	if err := stk.RunNamed(context.Background(), "test", nil); err != io.EOF {
+		t.Errorf("RunNamed of an effect that fails = %v, want %v", err, io.EOF)
+	}
+
+	bad := []struct {
+		name   string
+		params map[string]any
+	}{
+		{"nope", nil},
+		{"pulse", map[string]any{"period": "soon"}},
+		{"pulse", map[string]any{"color": 12}},
+		{"rainbow", map[string]any{"speed": 2}},
+		{"noise", map[string]any{"palette": []string{"red", "nope"}}},
+		{"flicker", map[string]any{"intensity": "high"}},
+	}
+	for _, test := range bad {
+		if err := stk.RunNamed(context.Background(), test.name, test.params); err == nil {
+			t.Errorf("RunNamed(%q, %v) didn't fail", test.name, test.params)
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.EnableWatchdog(time.Hour)
+	defer stk.DisableWatchdog()
+
+	h := stk.RunAsync(context.Background(), func(ctx context.Context) error {
+		return stk.Pulse(ctx, 0, Color{255, 0, 0}, 100*time.Millisecond)
+	})
+	time.Sleep(3 * frameInterval)
+
+	if err := stk.Sleep(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Done():
+	default:
+		t.Error("Sleep didn't stop the running animation")
+	}
+	if on, _ := stk.IsOn(0); on {
+		t.Error("Sleep left LEDs on")
+	}
+	if stk.shared().watchdog.timer != nil {
+		t.Error("Sleep left the watchdog running")
+	}
+
+	stk.Wake()
+	if stk.shared().watchdog.timer == nil {
+		t.Error("Wake didn't start the watchdog again")
+	}
+}
+
+func TestSchedulerFrameWithoutCount(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	device.SetError(errors.New("unplugged"))
+
+	s := &stk.shared().sched
+	if pixels := s.frame(stk, time.Now()); len(pixels) != 0 {
+		t.Errorf("frame with no count and no animators = %v, want empty", pixels)
+	}
+
+	stk.Schedule(2, AnimatorFunc(func(time.Time) Color { return Color{255, 0, 0} }))
+	want := []Color{{}, {}, {255, 0, 0}}
+	if pixels := s.frame(stk, time.Now()); !reflect.DeepEqual(pixels, want) {
+		t.Errorf("frame with no count = %v, want %v", pixels, want)
+	}
+}
+
+func TestNonPositiveIntervals(t *testing.T) {
+	stk := NewBlinkStick(testdevice.New(), "BS000001-3.0")
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"PaletteCycle", func() error { return stk.PaletteCycle(ctx, 0, []Color{{255, 0, 0}}, []int{0}, 0) }},
+		{"Scroll", func() error { return stk.Scroll(ctx, 0, 1, -time.Second) }},
+		{"Meter", func() error { return stk.Meter(ctx, 0, func() float64 { return 0 }, Color{}, Color{}, 0) }},
+		{"PlayStream", func() error { return stk.PlayStream(ctx, 0, strings.NewReader(""), 3, 0) }},
+		{"PlayStream", func() error { return stk.PlayStream(ctx, 0, strings.NewReader(""), 3, math.MaxInt32) }},
+	}
+	for _, test := range tests {
+		if err := test.run(); err == nil {
+			t.Errorf("%s with no time between frames didn't fail", test.name)
+		}
+	}
+}
+
+func TestNotifyPulseCount(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	for _, pulses := range []int{0, -1} {
+		err := stk.Notify(ctx, 0, Color{255, 0, 0}, pulses)
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Notify with %d pulses = %v, want an error straight away", pulses, err)
+		}
+	}
+	if writes := device.Writes(); len(writes) != 0 {
+		t.Errorf("Notify with no pulses wrote %v", writes)
+	}
+}
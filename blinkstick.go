@@ -9,69 +9,358 @@
  */
 
 // Package blinkstickgo provides functions to interact with the BlinkStick line of products.
+//
+// Animations take a context and run until they finish or it's done. One stopped by its
+// context always returns the context's error, whether or not it would ever have finished
+// on its own, so a cancelled animation can be told from one that failed or ran its
+// course. RunFor is there for when running out of time is the whole point.
 package blinkstickgo
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/gousb"
 )
 
-var ctx *gousb.Context
+var usbMu sync.Mutex // Guards usbCtx, which is nil until Init and after Fini.
+var usbCtx *gousb.Context
 const vendorID = 0x20A0
 const productID = 0x41E5
 
-// Init initializes the USB library.
+// DefaultControlTimeout is how long a control transfer may take before it's given up on,
+// unless changed with SetControlTimeout.
+const DefaultControlTimeout = 250 * time.Millisecond
+
+// How long control transfers may take, as a time.Duration, unless overridden per device.
+var controlTimeout = int64(DefaultControlTimeout)
+
+// ErrDeviceNotFound is returned when no connected BlinkStick matches the one asked for.
+var ErrDeviceNotFound = errors.New("blinkstick not found")
+
+// ErrUnsupported is returned when the device's firmware can't do what was asked.
+var ErrUnsupported = errors.New("not supported by this blinkstick")
+
+// ErrNotInitialized is returned when looking for BlinkSticks before Init or after Fini.
+var ErrNotInitialized = errors.New("blinkstick package not initialized")
+
+// Returned by transfers made with noWait set when the device is busy.
+var errBusy = errors.New("blinkstick busy")
+
+// Init initializes the USB library. Calling it again before Fini does nothing.
 func Init() {
-	ctx = gousb.NewContext()
+	usbMu.Lock()
+	defer usbMu.Unlock()
+	if usbCtx == nil {
+		usbCtx = gousb.NewContext()
+	}
 }
 
-// Fini closes the USB context.
+// Fini closes the USB context. Init can be called again afterwards to start over, and
+// calling Fini again, or without Init, does nothing.
 func Fini() {
-	ctx.Close()
+	usbMu.Lock()
+	defer usbMu.Unlock()
+	if usbCtx != nil {
+		usbCtx.Close()
+		usbCtx = nil
+	}
+}
+
+// Opens every BlinkStick plugged in, or returns ErrNotInitialized if Init hasn't been
+// called. Fini waits for it to finish.
+func openDevices() ([]*gousb.Device, error) {
+	usbMu.Lock()
+	defer usbMu.Unlock()
+	if usbCtx == nil {
+		return nil, ErrNotInitialized
+	}
+	return usbCtx.OpenDevices(filterBlinkStick)
 }
 
 // FindAll detects and returns all BlinkSticks connected to the system.
+//
+// The devices are opened once here and stay open until Close. Everything this package
+// sends goes over the default control endpoint, so no interface is ever claimed and
+// there's no claim/release cost paid per transfer.
 func FindAll() ([]BlinkStick, error) {
+	return FindAllContext(context.Background())
+}
+
+// FindAllContext is like FindAll, but gives up when ctx is done.
+//
+// libusb can't be interrupted while it's opening devices, so if ctx ends first, the
+// devices are closed in the background once it's finished and ctx's error is returned.
+func FindAllContext(ctx context.Context) ([]BlinkStick, error) {
 	var blinksticks []BlinkStick
 
-	devices, err := ctx.OpenDevices(filterBlinkStick)
-	if err != nil {
-		return blinksticks, err
+	type result struct {
+		devices []*gousb.Device
+		err     error
 	}
+	opened := make(chan result, 1)
+	go func() {
+		devices, err := openDevices()
+		opened <- result{devices, err}
+	}()
+
+	var devices []*gousb.Device
+	select {
+	case <-ctx.Done():
+		go func() {
+			for _, device := range (<-opened).devices {
+				device.Close()
+			}
+		}()
+		return blinksticks, ctx.Err()
+	case res := <-opened:
+		if res.err != nil {
+			return blinksticks, res.err
+		}
+		devices = res.devices
+	}
+
+	for i, device := range devices {
+		if ctx.Err() != nil {
+			for _, device := range devices[i:] {
+				device.Close()
+			}
+			for _, stk := range blinksticks {
+				stk.Close()
+			}
+			return nil, ctx.Err()
+		}
 
-	for _, device := range devices {
 		serial, err := device.SerialNumber()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Could not grab Serial for BlinkStick device", err)
 		}
-		blinksticks = append(blinksticks, BlinkStick{
-			Device: device,
-			Inverse: false, // TODO: The device knows this, right? We should query for it.
-			Serial: serial,
-		})
+		blinksticks = append(blinksticks, *NewBlinkStick(device, serial))
 	}
 	return blinksticks, nil
 }
 
+// SetControlTimeout sets how long any control transfer may take before it's given up on.
+//
+// It defaults to DefaultControlTimeout, 250ms, and a timeout of 0 means transfers wait
+// forever. Individual sticks can override it with their own SetControlTimeout.
+func SetControlTimeout(d time.Duration) {
+	atomic.StoreInt64(&controlTimeout, int64(d))
+}
+
+// WaitForDevice blocks until at least one BlinkStick is connected, scanning every poll interval.
+//
+// The first stick found is returned and any others are closed. Failed scans are retried
+// until ctx is done, at which point ctx's error is returned.
+func WaitForDevice(ctx context.Context, poll time.Duration) (*BlinkStick, error) {
+	return waitFor(ctx, poll, func(stk *BlinkStick) bool { return true })
+}
+
+// WaitForSerial is like WaitForDevice, but waits for the BlinkStick with the given serial.
+func WaitForSerial(ctx context.Context, serial string, poll time.Duration) (*BlinkStick, error) {
+	return waitFor(ctx, poll, func(stk *BlinkStick) bool { return stk.Serial == serial })
+}
+
+// IsPresent reports whether the BlinkStick with the given serial is plugged in.
+//
+// libusb can only read a serial from an open device, so each BlinkStick is opened just
+// long enough to read it. Nothing is claimed along the way, so this won't fight with
+// another process that's using the stick.
+func IsPresent(serial string) (bool, error) {
+	device, err := openSerial(serial)
+	if device != nil {
+		device.Close()
+	}
+	return device != nil, err
+}
+
+// Opens the BlinkStick with the given serial, or returns nil if it isn't plugged in. Every
+// other BlinkStick is only opened long enough to read its serial.
+func openSerial(serial string) (*gousb.Device, error) {
+	devices, err := openDevices()
+	var found *gousb.Device
+	for _, device := range devices {
+		deviceSerial, serialErr := device.SerialNumber()
+		if found == nil && serialErr == nil && deviceSerial == serial {
+			found = device
+		} else {
+			device.Close()
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	return nil, err
+}
+
+// Scans for BlinkSticks until one satisfies match or ctx is done.
+func waitFor(ctx context.Context, poll time.Duration, match func(*BlinkStick) bool) (*BlinkStick, error) {
+	for {
+		sticks, err := FindAll()
+		if err == nil {
+			if found := pick(sticks, match); found != nil {
+				return found, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Returns the first stick satisfying match, closing all the others.
+func pick(sticks []BlinkStick, match func(*BlinkStick) bool) *BlinkStick {
+	var found *BlinkStick
+	for i := range sticks {
+		if found == nil && match(&sticks[i]) {
+			found = &sticks[i]
+		} else {
+			sticks[i].Device.Close()
+		}
+	}
+	return found
+}
+
 // The BlinkStick struct represents an individual BlinkStick device.
 type BlinkStick struct {
-	Device   *gousb.Device
+	Device   Device
 	Serial   string
-	Inverse  bool
-	RGB      bool // Currently unimplemented, will be true if the strip uses RGB format instead of the default GRB.
+	Inverse  bool // Inverts every channel that hasn't been given its own setting with SetInverseChannel.
+	RGB      bool // True if the LEDs take RGB format instead of GRB. FindAll guesses from the variant.
+	RGBW     bool // True if the LEDs have a white channel too, as some Flex builds do. See SetRGBW.
+	Events   EventMap
+	Channels int // Overrides the channel count reported by ChannelCount when nonzero.
 	ledCount int
+	gamma    *gammaCorrection
+	balance  *[3]float64 // Per channel color correction multipliers applied after gamma, if set.
+	filter   func(Color) Color
+	dim      float64 // One minus the brightness, so the zero value is full brightness.
+	channel  byte    // The channel used by the methods that don't take one.
+	layout   Layout
+	rand     *rand.Rand
+	state    *deviceState
+	noWait   bool // Makes transfers fail with errBusy rather than wait for the device.
+	reversed bool
+	inverted map[byte]bool // Per channel overrides of Inverse. Replaced, never modified, so copies can share it.
+
+	timeout        *time.Duration // Overrides the package's control timeout when set.
+	restoreOnClose bool
+	savedMode      *Mode // The mode the device was in before SetMode first changed it.
+	background     bool  // Set on the copies background loops write with, so the watchdog ignores them.
+	ringOffset     int   // The physical LED index 0 maps to, after any reversal.
+}
+
+// State shared between every copy of a BlinkStick, since they all drive the same device.
+type deviceState struct {
+	mu sync.Mutex // Held for the length of each control transfer.
+
+	hookMu  sync.Mutex
+	onError func(err error)
+
+	stats    transferStats
+	sched    scheduler
+	dither   ditherer
+	mirror   frameMirror
+	reports  reportTable
+	zones    zoneTable
+	layers   layerTable
+	buffers  frameBuffers
+	watchdog watchdog
+	flashes  flashTable
+	scenes   sceneTable
+	sleep    sleepState
+	running  animationTable
+
+	// Set when the device has been reconnected, so every copy switches to the new
+	// handle. Guarded by mu, as is the number of times to try reconnecting.
+	device     Device
+	reconnects int
+}
+
+// Scratch space for packing frames, kept between writes.
+type frameBuffers struct {
+	mu     sync.Mutex // Held while the buffers are in use, before the device's mutex.
+	pixels []Color
+	data   []byte
+	report []byte
+}
+
+// Returns the stick's shared state, creating it if this is a hand-built BlinkStick.
+func (stk *BlinkStick) shared() *deviceState {
+	if stk.state == nil {
+		stk.state = &deviceState{}
+	}
+	return stk.state
+}
+
+// Close releases the device. The BlinkStick can't be used afterwards.
+//
+// If RestoreOnClose is on and SetMode has changed the device's mode, the LEDs are turned
+// off and the original mode is put back first.
+func (stk *BlinkStick) Close() error {
+	stk.EnableTemporalDither(false)
+	stk.DisableWatchdog()
+	if stk.restoreOnClose && stk.savedMode != nil {
+		stk.OffAllChannels()
+		stk.SetMode(*stk.savedMode)
+	}
+
+	state := stk.shared()
+	state.mu.Lock()
+	stk.syncDevice(state)
+	state.mu.Unlock()
+	return stk.Device.Close()
+}
+
+// RestoreOnClose sets whether Close should undo any mode changes, so the next program to
+// use the stick doesn't find it stuck in, say, inverse mode.
+//
+// It only affects sticks whose mode is changed with SetMode after this is turned on.
+func (stk *BlinkStick) RestoreOnClose(restore bool) {
+	stk.restoreOnClose = restore
+}
+
+// OnControlError registers a function to be called with the error whenever a control
+// transfer fails, say to raise an alarm elsewhere. Pass nil to remove it.
+//
+// It's called after the device has been let go of, so it's free to use the stick itself,
+// for instance to try flashing an error color.
+func (stk *BlinkStick) OnControlError(fn func(err error)) {
+	state := stk.shared()
+
+	state.hookMu.Lock()
+	state.onError = fn
+	state.hookMu.Unlock()
+}
+
+// SetControlTimeout overrides the package's control transfer timeout for this stick alone.
+func (stk *BlinkStick) SetControlTimeout(d time.Duration) {
+	stk.timeout = &d
 }
 
 // GetLEDCount returns the number of LEDs for supported devices.
+//
+// The Nano always has two, whatever it reports: index 0 is the LED on top of the board
+// and index 1 is the one underneath.
 func (stk *BlinkStick) GetLEDCount() int {
+	if stk.ledCount == 0 && stk.GetVariant() == VariantNano {
+		stk.ledCount = 2
+	}
 	if stk.ledCount == 0 {
 		buffer := make([]byte, 2)
 
-		responseLen, err := stk.Device.Control(0x80|0x20, 0x01, 0x81, 0x00, buffer)
+		responseLen, err := stk.transfer(0x80|0x20, 0x01, 0x81, 0x00, buffer)
 		if err != nil || responseLen < 2 {
 			return -1
 		}
@@ -82,30 +371,50 @@ func (stk *BlinkStick) GetLEDCount() int {
 	return stk.ledCount
 }
 
+// IsAlive reports whether the device still answers, for spotting a handle that's gone
+// stale, say after the host has been suspended. It reads the LED count report, which
+// leaves the LEDs alone. A dead stick needs to be closed and found again.
+func (stk *BlinkStick) IsAlive() bool {
+	buffer := make([]byte, 2)
+	return stk.control(0x80|0x20, 0x01, 0x81, 0x00, buffer) == nil
+}
+
 // GetName returns the name of the device.
+//
+// This is the name kept in info block one, which anyone can change with SetName. It's
+// not the product name the device gives the USB host; see ProductString for that.
 func (stk *BlinkStick) GetName() string {
-	buffer := make([]byte, 33)
+	name, _ := stk.readInfoBlock(0x02)
+	return name
+}
 
-	err := stk.control(0x80|0x20, 0x01, 0x02, 0x00, buffer)
-	if err != nil {
-		return ""
-	}
+// ProductString returns the product name from the device's USB string descriptor, the
+// same name lsusb and friends show. Unlike GetName, it's fixed in the firmware.
+func (stk *BlinkStick) ProductString() (string, error) {
+	return stk.Device.Product()
+}
 
-	buffer = append(buffer, 0) // Just in case there's no terminating null byte, we'll add our own.
-	return string(buffer)
+// ManufacturerString returns the manufacturer from the device's USB string descriptor.
+func (stk *BlinkStick) ManufacturerString() (string, error) {
+	return stk.Device.Manufacturer()
 }
 
 // GetInfo returns a string of data from info block two.
 func (stk *BlinkStick) GetInfo() string {
+	info, _ := stk.readInfoBlock(0x03)
+	return info
+}
+
+// Reads the string kept in an info block, by its report ID.
+func (stk *BlinkStick) readInfoBlock(reportID uint16) (string, error) {
 	buffer := make([]byte, 33)
 
-	err := stk.control(0x80|0x20, 0x01, 0x03, 0x00, buffer)
+	err := stk.control(0x80|0x20, 0x01, reportID, 0x00, buffer)
 	if err != nil {
-		return ""
+		return "", err
 	}
 
-	buffer = append(buffer, 0) // Just in case there's no terminating null byte, we'll add our own.
-	return string(buffer)
+	return infoString(buffer), nil
 }
 
 // SetName writes a new name for the device to info block one.
@@ -124,37 +433,416 @@ func (stk *BlinkStick) SetInfo(info string) error {
 	return stk.control(0x20, 0x09, 0x03, 0x00, []byte(info))
 }
 
+// SetPowerOnColor would set the color the device shows when it's powered up without a host.
+//
+// None of the current BlinkStick firmware has anywhere to keep such a color; every
+// variant starts dark until told otherwise. This always returns ErrUnsupported for now,
+// and is here so appliance-style code has a single place to pick it up later.
+func (stk *BlinkStick) SetPowerOnColor(c Color) error {
+	return ErrUnsupported
+}
+
+// DeviceStatus is the power status a device reports about itself.
+type DeviceStatus struct {
+	Overcurrent bool    // True if the LEDs have drawn more than the supply can give.
+	Voltage     float64 // The input voltage in volts, or 0 if it isn't measured.
+}
+
+// Status reads the device's power status, for diagnosing long strips browning out on USB
+// power.
+//
+// No BlinkStick firmware so far has a status report: not the original, the Pro, the
+// Square, the Strip, the Nano, or the Flex. This always returns ErrUnsupported until
+// one does. A strip dimming or shifting toward red at the far end is the usual sign of
+// a supply that can't keep up.
+func (stk *BlinkStick) Status() (DeviceStatus, error) {
+	return DeviceStatus{}, ErrUnsupported
+}
+
+// EnterBootloader restarts the device into its bootloader for a firmware update, after
+// which it disconnects and comes back as a different USB device. The BlinkStick can't
+// be used afterwards, and should be closed.
+//
+// No BlinkStick firmware so far takes a DFU detach request, or any other request that
+// jumps to the bootloader, so this always returns ErrUnsupported until one does. Until
+// then, the bootloader has to be entered by hand, the way the board's flashing
+// instructions describe.
+func (stk *BlinkStick) EnterBootloader() error {
+	return ErrUnsupported
+}
+
+// Mode is the mode a BlinkStick Pro drives its LEDs in.
+type Mode byte
+
+// The modes understood by the BlinkStick firmware.
+const (
+	ModeNormal  Mode = 0
+	ModeInverse Mode = 1 // For common anode RGB LEDs.
+	ModeWS2812  Mode = 2 // For smart pixel strips.
+)
+
+// String returns a lowercase name for the mode, or unknown(n) if it isn't one we know.
+func (m Mode) String() string {
+	switch m {
+	case ModeNormal:
+		return "normal"
+	case ModeInverse:
+		return "inverse"
+	case ModeWS2812:
+		return "ws2812"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(m))
+}
+
+// GetMode reads the mode the device is in.
+func (stk *BlinkStick) GetMode() (Mode, error) {
+	buffer := make([]byte, 2)
+
+	err := stk.control(0x80|0x20, 0x01, 0x04, 0x00, buffer)
+	if err != nil {
+		return 0, err
+	}
+	return Mode(buffer[1]), nil
+}
+
+// SetMode changes the mode of the device.
+func (stk *BlinkStick) SetMode(mode Mode) error {
+	if stk.restoreOnClose && stk.savedMode == nil {
+		original, err := stk.GetMode()
+		if err != nil {
+			return err
+		}
+		stk.savedMode = &original
+	}
+	return stk.control(0x20, 0x09, 0x04, 0x00, []byte{4, byte(mode)})
+}
+
+// ModeString reads the mode the device is in and returns its name, for diagnostics.
+func (stk *BlinkStick) ModeString() (string, error) {
+	mode, err := stk.GetMode()
+	if err != nil {
+		return "", err
+	}
+	return mode.String(), nil
+}
+
 // SetRGB sets one LED to a color in RGB format.
 func (stk *BlinkStick) SetRGB(channel, index, r, g, b byte) error {
-	if stk.Inverse {
-		r, g, b = 255-r, 255-g, 255-b
+	c := Color{r, g, b}
+	r, g, b = stk.correct(channel, r, g, b)
+	physical := stk.physicalIndex(index)
+
+	var err error
+	if physical == 0 && channel == 0 {
+		err = stk.control(0x20, 0x09, 0x01, 0x00, []byte{0, r, g, b})
+	} else {
+		err = stk.control(0x20, 0x09, 0x05, 0x00, []byte{5, channel, physical, r, g, b})
+	}
+	if err == nil {
+		stk.shared().mirror.patch(channel, int(index), c)
 	}
+	return err
+}
 
-	if index == 0 && channel == 0 {
-		return stk.control(0x20, 0x09, 0x01, 0x00, []byte{0, r, g, b})
+// VerifySet sets one LED to a color, then reads it back to confirm the write took effect.
+//
+// The BlinkStick tends to chew up colors a little, so each component only needs to be
+// within tolerance of the target. The color actually read back is returned for logging.
+func (stk *BlinkStick) VerifySet(channel, index byte, c Color, tolerance byte) (bool, Color, error) {
+	err := stk.SetRGB(channel, index, c.R, c.G, c.B)
+	if err != nil {
+		return false, Color{}, err
+	}
+
+	data, err := stk.GetChannelLEDData(channel, int(index)+1)
+	if err != nil {
+		return false, Color{}, err
 	}
-	return stk.control(0x20, 0x09, 0x05, 0x00, []byte{5, channel, index, r, g, b})
+
+	actual := stk.decodeColor(channel, data[int(index)*3:])
+	c = stk.process(c) // The device only ever sees the corrected color.
+	ok := within(actual.R, c.R, tolerance) && within(actual.G, c.G, tolerance) && within(actual.B, c.B, tolerance)
+	return ok, actual, nil
+}
+
+// SetIfChanged sets one LED, but only if the new color is more than threshold away from
+// the last one written to it in any component, so that a noisy sensor doesn't flood the
+// bus with changes no one can see. It reports whether it wrote anything.
+//
+// The last color comes from LastFrame. If there isn't one, the LED is always set.
+func (stk *BlinkStick) SetIfChanged(channel, index byte, c Color, threshold byte) (bool, error) {
+	frame, ok := stk.LastFrame(channel)
+	if ok && int(index) < len(frame.Pixels) {
+		last := frame.Pixels[index]
+		if within(last.R, c.R, threshold) && within(last.G, c.G, threshold) && within(last.B, c.B, threshold) {
+			return false, nil
+		}
+	}
+	err := stk.SetRGB(channel, index, c.R, c.G, c.B)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // SetRandom sets one LED to a random color.
 func (stk *BlinkStick) SetRandom(channel, index byte) error {
-	rColor := rand.Uint32()
+	rColor := stk.randUint32()
 	return stk.SetRGB(channel, index, byte(rColor>>24), byte(rColor>>16), byte(rColor>>8))
 }
 
+// SetRand sets where SetRandom and the animations get their randomness, for repeatable
+// effects or tests. Like any *rand.Rand, it mustn't be shared between goroutines. By
+// default the top-level math/rand functions are used.
+func (stk *BlinkStick) SetRand(r *rand.Rand) {
+	stk.rand = r
+}
+
+// Returns a random uint32 from the stick's random source.
+func (stk *BlinkStick) randUint32() uint32 {
+	if stk.rand == nil {
+		return rand.Uint32()
+	}
+	return stk.rand.Uint32()
+}
+
+// Returns a random float64 in [0, 1) from the stick's random source.
+func (stk *BlinkStick) randFloat64() float64 {
+	if stk.rand == nil {
+		return rand.Float64()
+	}
+	return stk.rand.Float64()
+}
+
+// SetHealth sets one LED to a color on a red-yellow-green scale for a percentage.
+//
+// 0 is red, 50 is yellow and 100 is green. Anything outside that range is clamped.
+func (stk *BlinkStick) SetHealth(channel, index byte, percent float64) error {
+	percent = math.Max(0, math.Min(100, percent))
+
+	var c Color
+	if percent < 50 {
+		c = MixColors(Color{255, 0, 0}, Color{255, 255, 0}, percent/50)
+	} else {
+		c = MixColors(Color{255, 255, 0}, Color{0, 255, 0}, (percent-50)/50)
+	}
+	return stk.SetRGB(channel, index, c.R, c.G, c.B)
+}
+
 // SetAllRGB sends a color to all LEDs on a channel in RGB format.
 func (stk *BlinkStick) SetAllRGB(channel, r, g, b byte) error {
-	count := stk.GetLEDCount()
+	return stk.SetAllRGBN(channel, stk.GetLEDCount(), r, g, b)
+}
+
+// SetAllRGBN is like SetAllRGB, but takes the LED count rather than asking the device for it.
+//
+// Handy in animation loops where the length of the strip is already known. A negative
+// count sets just the first LED, the same way SetAllRGB does for the Pro.
+func (stk *BlinkStick) SetAllRGBN(channel byte, count int, r, g, b byte) error {
 	if count < 0 {
 		return stk.SetRGB(channel, 0, r, g, b)
 	}
-	data := bytes.Repeat([]byte{r, g, b}, count)
-	return stk.SetLEDData(channel, data)
+	buf, err := stk.lockBuffers()
+	if err != nil {
+		return err
+	}
+	defer buf.mu.Unlock()
+
+	buf.pixels = buf.pixels[:0]
+	for i := 0; i < count; i++ {
+		buf.pixels = append(buf.pixels, Color{r, g, b})
+	}
+	return stk.writeFrameBuffered(channel, buf.pixels, buf)
+}
+
+// TrySetAll is SetAllRGB for real-time loops that would rather drop a frame than stall.
+//
+// If another transfer to the device is under way, it gives up straight away and returns
+// false. Otherwise the LEDs are set and it returns true.
+func (stk *BlinkStick) TrySetAll(channel byte, c Color) (bool, error) {
+	count := stk.GetLEDCount()
+
+	try := *stk
+	try.noWait = true
+	err := try.SetAllRGBN(channel, count, c.R, c.G, c.B)
+	if err == errBusy {
+		return false, nil
+	}
+	return true, err
+}
+
+// SetReversed flips the order of the LEDs, so index 0 is the last LED on the strip, for
+// strips mounted the other way around. It applies to everything that sets or reads LEDs.
+//
+// Devices that can't say how many LEDs they have, like the Pro, aren't affected.
+func (stk *BlinkStick) SetReversed(reversed bool) {
+	stk.reversed = reversed
+}
+
+// SetInverseChannel sets whether one channel's LEDs are common anode and need their colors
+// inverted, for a Pro with different strips on each channel. Channels it hasn't been
+// called for follow the Inverse field, so setting Inverse still inverts everything else.
+func (stk *BlinkStick) SetInverseChannel(channel byte, inverse bool) {
+	inverted := make(map[byte]bool, len(stk.inverted)+1)
+	for ch, v := range stk.inverted {
+		inverted[ch] = v
+	}
+	inverted[channel] = inverse
+	stk.inverted = inverted
+}
+
+// Returns true if colors on channel are inverted on their way to and from the device.
+func (stk *BlinkStick) isInverse(channel byte) bool {
+	if inverse, ok := stk.inverted[channel]; ok {
+		return inverse
+	}
+	return stk.Inverse
+}
+
+// SetRingOffset rotates the LEDs, so index 0 is physical LED offset and the indexes past
+// the end of the strip wrap around to its start, for rings where the first LED isn't
+// where effects should start from. Negative offsets rotate the other way. Like
+// SetReversed, it applies to everything that sets or reads LEDs.
+//
+// The offset counts physical LEDs, so with the strip reversed too, index 0 is offset LEDs
+// on from the last one. Devices that can't say how many LEDs they have, like the Pro,
+// aren't affected.
+func (stk *BlinkStick) SetRingOffset(offset int) {
+	stk.ringOffset = offset
+}
+
+// Returns true if LED indexes on a strip of count LEDs need mapping to physical ones,
+// because the strip is reversed or rotated.
+func (stk *BlinkStick) remaps(count int) bool {
+	return count > 0 && (stk.reversed || stk.ringOffset%count != 0)
+}
+
+// Maps a logical LED index to the physical one, which differ if the strip is reversed or
+// rotated.
+func (stk *BlinkStick) physicalIndex(index byte) byte {
+	count := stk.GetLEDCount()
+	if !stk.remaps(count) || int(index) >= count {
+		return index
+	}
+	return byte(stk.physicalLED(int(index), count))
+}
+
+// Does the work of physicalIndex for a strip of count LEDs.
+func (stk *BlinkStick) physicalLED(index, count int) int {
+	if stk.reversed {
+		index = count - 1 - index
+	}
+	return ((index+stk.ringOffset)%count + count) % count
+}
+
+// Puts the LEDs in packed data in their physical order, padding or truncating it to count
+// LEDs first so every LED lands where it belongs.
+func (stk *BlinkStick) toPhysical(data []byte, count int) []byte {
+	physical := make([]byte, count*3)
+	for i := 0; i < count && i*3+2 < len(data); i++ {
+		copy(physical[stk.physicalLED(i, count)*3:], data[i*3:i*3+3])
+	}
+	return physical
+}
+
+// Undoes toPhysical, for LED data read from the device.
+func (stk *BlinkStick) fromPhysical(data []byte, count int) []byte {
+	logical := make([]byte, count*3)
+	for i := 0; i < count; i++ {
+		if p := stk.physicalLED(i, count); p*3+2 < len(data) {
+			copy(logical[i*3:], data[p*3:p*3+3])
+		}
+	}
+	return logical
+}
+
+// Returns a copy of the stick that addresses LEDs by their physical indexes.
+func (stk *BlinkStick) unmapped() *BlinkStick {
+	physical := *stk
+	physical.reversed = false
+	physical.ringOffset = 0
+	return &physical
+}
+
+// SetDefaultChannel sets the channel SetRGBDefault and SetAllDefault use. It starts at 0,
+// which is the only channel anything but a Pro has.
+func (stk *BlinkStick) SetDefaultChannel(channel byte) {
+	stk.channel = channel
+}
+
+// SetRGBDefault is SetRGB on the default channel.
+func (stk *BlinkStick) SetRGBDefault(index, r, g, b byte) error {
+	return stk.SetRGB(stk.channel, index, r, g, b)
+}
+
+// SetAllDefault is SetAllRGB on the default channel.
+func (stk *BlinkStick) SetAllDefault(r, g, b byte) error {
+	return stk.SetAllRGB(stk.channel, r, g, b)
+}
+
+// SetPacked updates the entire stick from a slice of 0x00RRGGBB words, one per LED.
+//
+// The slice is padded with black or truncated to fit the LED count.
+func (stk *BlinkStick) SetPacked(channel byte, pixels []uint32) error {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = len(pixels)
+	}
+
+	colors := make([]Color, count)
+	for i := 0; i < count && i < len(pixels); i++ {
+		colors[i] = Color{byte(pixels[i] >> 16), byte(pixels[i] >> 8), byte(pixels[i])}
+	}
+	return stk.writeFrame(channel, colors)
+}
+
+// Off turns off every LED on a channel.
+//
+// The Pro can't report how many LEDs hang off each channel, so all 64 are cleared.
+func (stk *BlinkStick) Off(channel byte) error {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		if stk.GetVariant() != VariantPro {
+			return stk.SetRGB(channel, 0, 0, 0, 0)
+		}
+		count = 64
+	}
+
+	return stk.writeFrame(channel, make([]Color, count))
+}
+
+// OffAllChannels turns off every LED on every channel the device has.
+func (stk *BlinkStick) OffAllChannels() error {
+	for channel := 0; channel < stk.ChannelCount(); channel++ {
+		err := stk.Off(byte(channel))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetLEDData retrieves the LED data from the device.
+//
+// Devices that can't say how many LEDs they have, like the Pro, have no LED data report
+// to read. Asking one of them for a single LED reads back the color set on it instead.
+// Asking for more LEDs than the largest report holds is an error.
 func (stk *BlinkStick) GetLEDData(count int) ([]byte, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("can't read %d LEDs", count)
+	}
+	if count <= 1 && stk.GetLEDCount() < 0 {
+		return stk.getSingleLED()
+	}
+	if total := stk.GetLEDCount(); stk.remaps(total) && count <= total {
+		data, err := stk.unmapped().GetLEDData(total)
+		return stk.fromPhysical(data, total)[:count*3], err
+	}
+
 	reportID, maxLEDs := stk.getReportID(count*3)
+	if count > int(maxLEDs) {
+		return nil, fmt.Errorf("can't read %d LEDs, the largest report holds %d", count, maxLEDs)
+	}
 	buffer := make([]byte, 2 + maxLEDs * 3)
 
 	err := stk.control(0x80|0x20, 0x01, reportID, 0x00, buffer)
@@ -162,34 +850,340 @@ func (stk *BlinkStick) GetLEDData(count int) ([]byte, error) {
 	return buffer[2:2+count*3], err
 }
 
-// SetLEDData updates the entire stick with a slice of alternating RGB values.
+// Reads the first LED's color from report 1, which always holds it in RGB order, and
+// returns it in the device's byte order like the LED data reports.
+func (stk *BlinkStick) getSingleLED() ([]byte, error) {
+	buffer := make([]byte, 4)
+
+	err := stk.control(0x80|0x20, 0x01, 0x01, 0x00, buffer)
+	if err != nil {
+		return nil, err
+	}
+	if stk.RGB {
+		return buffer[1:4], nil
+	}
+	return []byte{buffer[2], buffer[1], buffer[3]}, nil
+}
+
+// GetChannelLEDData retrieves the LED data for one channel of the device.
+//
+// The channel goes out as the report index, and the device echoes back which channel its
+// data belongs to. If that doesn't match, the firmware can't read back that channel
+// and an error is returned rather than another channel's data. So is asking for more
+// LEDs than the largest report holds.
+func (stk *BlinkStick) GetChannelLEDData(channel byte, count int) ([]byte, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("can't read %d LEDs", count)
+	}
+	if total := stk.GetLEDCount(); stk.remaps(total) && count <= total {
+		data, err := stk.unmapped().GetChannelLEDData(channel, total)
+		if err != nil {
+			return nil, err
+		}
+		return stk.fromPhysical(data, total)[:count*3], nil
+	}
+
+	reportID, maxLEDs := stk.getReportID(count * 3)
+	if count > int(maxLEDs) {
+		return nil, fmt.Errorf("can't read %d LEDs, the largest report holds %d", count, maxLEDs)
+	}
+	buffer := make([]byte, 2+maxLEDs*3)
+
+	err := stk.control(0x80|0x20, 0x01, reportID, uint16(channel), buffer)
+	if err != nil {
+		return nil, err
+	}
+	if buffer[1] != channel {
+		return nil, fmt.Errorf("asked for channel %d, but the device sent channel %d", channel, buffer[1])
+	}
+	return buffer[2 : 2+count*3], nil
+}
+
+// GetAllLEDData retrieves the LED data for every channel, indexed by channel.
+//
+// It's the whole state of a Pro rig in one go, handy for restoring it later.
+func (stk *BlinkStick) GetAllLEDData() ([][]byte, error) {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 64
+	}
+
+	all := make([][]byte, stk.ChannelCount())
+	for channel := range all {
+		data, err := stk.GetChannelLEDData(byte(channel), count)
+		if err != nil {
+			return nil, err
+		}
+		all[channel] = data
+	}
+	return all, nil
+}
+
+// SetLEDData updates the entire stick with a slice of alternating RGB values, or RGBW
+// values if the RGBW field is set.
+//
+// The data goes through PackFrame, so it's reordered and corrected like any other color.
 func (stk *BlinkStick) SetLEDData(channel byte, data []byte) error {
+	if stk.RGBW {
+		return stk.setRGBWData(channel, data)
+	}
+
+	return stk.writeFrame(channel, rgbColors(data))
+}
+
+// SetLEDDataReport is SetLEDData with the report ID forced, rather than picked to fit the
+// data. It's an escape hatch for experimental firmware and hardware that maps its reports
+// differently; on anything else, SetLEDData is the safe choice.
+//
+// The data is packed and corrected as usual, but sent as is, without being padded out to
+// the report's length, reversed, or rotated. A report the firmware doesn't expect, or
+// data of the wrong length for it, is likely to do nothing at all or fail. LastFrame
+// forgets the channel, since what ends up on the LEDs can't be known.
+func (stk *BlinkStick) SetLEDDataReport(channel byte, reportID uint16, data []byte) error {
+	report := append([]byte{0, channel}, stk.appendFrame(nil, channel, rgbColors(data))...)
+
+	state := stk.shared()
+	state.dither.forget(channel)
+	state.mirror.forget(channel)
+	return stk.control(0x20, 0x09, reportID, 0x00, report)
+}
+
+// Turns a slice of alternating RGB values into colors, padding out the last one with zeros
+// if the slice is short.
+func rgbColors(data []byte) []Color {
+	padded := make([]byte, (len(data)+2)/3*3)
+	copy(padded, data)
+
+	pixels := make([]Color, len(padded)/3)
+	for i := range pixels {
+		pixels[i] = Color{padded[i*3], padded[i*3+1], padded[i*3+2]}
+	}
+	return pixels
+}
+
+// PackFrame turns a slice of colors into LED data exactly as the device expects it.
+//
+// Brightness, gamma, and inversion are applied and the colors are put in the device's
+// byte order, just as every setter in this package does before writing. It's for anyone
+// generating their own frames who needs to know exactly what goes over the wire. The
+// default channel's inversion setting is the one used.
+func (stk *BlinkStick) PackFrame(pixels []Color) []byte {
+	return stk.appendFrame(make([]byte, 0, len(pixels)*3), stk.channel, pixels)
+}
+
+// Packs a frame like PackFrame for the given channel, appending it to data.
+func (stk *BlinkStick) appendFrame(data []byte, channel byte, pixels []Color) []byte {
+	for _, c := range pixels {
+		data = stk.appendColor(data, channel, c.R, c.G, c.B)
+	}
+	return data
+}
+
+// UnpackFrame turns LED data read from the device back into colors.
+//
+// The byte order and any inversion are undone. Brightness and gamma can't be undone
+// exactly, so the colors come back as the LEDs actually show them. Like PackFrame, it
+// goes by the default channel's inversion setting.
+func (stk *BlinkStick) UnpackFrame(data []byte) []Color {
+	return stk.unpackFrame(stk.channel, data)
+}
+
+// Unpacks LED data like UnpackFrame, for the channel it was read from.
+func (stk *BlinkStick) unpackFrame(channel byte, data []byte) []Color {
+	pixels := make([]Color, len(data)/3)
+	for i := range pixels {
+		pixels[i] = stk.decodeColor(channel, data[i*3:])
+	}
+	return pixels
+}
+
+// Packs and writes a whole frame of colors in one transfer.
+func (stk *BlinkStick) writeFrame(channel byte, pixels []Color) error {
+	buf, err := stk.lockBuffers()
+	if err != nil {
+		return err
+	}
+	defer buf.mu.Unlock()
+	return stk.writeFrameBuffered(channel, pixels, buf)
+}
+
+// Locks the frame buffers, which stay locked for as long as the transfer they're packed
+// into. Like transfer, it fails with errBusy rather than wait if the stick is noWait.
+func (stk *BlinkStick) lockBuffers() (*frameBuffers, error) {
+	buf := &stk.shared().buffers
+	if !stk.noWait {
+		buf.mu.Lock()
+	} else if !buf.mu.TryLock() {
+		return nil, errBusy
+	}
+	return buf, nil
+}
+
+// Does the work of writeFrame, packing the frame into buffers that are reused from one
+// frame to the next so that animation loops don't allocate. The buffers must be locked.
+func (stk *BlinkStick) writeFrameBuffered(channel byte, pixels []Color, buf *frameBuffers) error {
+	stk.shared().dither.remember(stk, channel, pixels)
+
+	buf.data = stk.appendFrame(buf.data[:0], channel, pixels)
+	report, err := stk.sendLEDData(channel, buf.data, buf.report[:0])
+	buf.report = report
+	if err == nil {
+		stk.shared().mirror.store(channel, pixels)
+	}
+	return err
+}
+
+// Writes LED data that's already been packed, padding it out to the size of the report.
+func (stk *BlinkStick) writeLEDData(channel byte, data []byte) error {
+	_, err := stk.sendLEDData(channel, data, nil)
+	return err
+}
+
+// Writes LED data like writeLEDData, building the report by appending to report, which is
+// returned for reuse.
+func (stk *BlinkStick) sendLEDData(channel byte, data, report []byte) ([]byte, error) {
+	if count := stk.GetLEDCount(); stk.remaps(count) {
+		data = stk.toPhysical(data, count)
+	}
 	reportID, maxLEDs := stk.getReportID(len(data))
-	report := []byte{0, channel}
+	report = append(report, 0, channel)
 
 	for i := 0; uint16(i) < maxLEDs*3; i++ {
-		if len(data) > i { // TODO: Support Inverse
+		if len(data) > i {
 			report = append(report, data[i])
 		} else {
 			report = append(report, 0)
 		}
 	}
-	return stk.control(0x20, 0x09, reportID, 0x00, report)
+	return report, stk.control(0x20, 0x09, reportID, 0x00, report)
 }
 
-// A razor thin wrapper around gousb.Device.Control().
+// A razor thin wrapper around transfer() for when the response length doesn't matter.
 func (stk *BlinkStick) control(requestType, request uint8, val, idx uint16, data []byte) error {
-	_, err := stk.Device.Control(requestType, request, val, idx, data)
+	_, err := stk.transfer(requestType, request, val, idx, data)
 	return err
 }
 
+// Every control transfer goes through here, so it's where they're counted. The device's
+// interface doesn't need to be claimed for control transfers, so it never is.
+func (stk *BlinkStick) transfer(requestType, request uint8, val, idx uint16, data []byte) (int, error) {
+	state := stk.shared()
+
+	if !stk.noWait {
+		state.mu.Lock()
+	} else if !state.mu.TryLock() {
+		return 0, errBusy
+	}
+	stk.syncDevice(state)
+	n, err := stk.sendControl(requestType, request, val, idx, data)
+	if err != nil && state.reconnects > 0 && isDisconnect(err) && stk.reconnect(state) {
+		n, err = stk.sendControl(requestType, request, val, idx, data)
+	}
+	state.mu.Unlock()
+
+	if err == nil && requestType&0x80 == 0 && !stk.background {
+		state.watchdog.kick(stk)
+	}
+	state.stats.record(err)
+	if err != nil {
+		state.hookMu.Lock()
+		onError := state.onError
+		state.hookMu.Unlock()
+		if onError != nil {
+			onError(err)
+		}
+	}
+	return n, err
+}
+
+// Makes a single control transfer, with the device's mutex already held.
+func (stk *BlinkStick) sendControl(requestType, request uint8, val, idx uint16, data []byte) (int, error) {
+	if stk.timeout != nil {
+		stk.setDeviceTimeout(*stk.timeout)
+	} else {
+		stk.setDeviceTimeout(time.Duration(atomic.LoadInt64(&controlTimeout)))
+	}
+	return stk.Device.Control(requestType, request, val, idx, data)
+}
+
+// Applies brightness, gamma, color correction, any filter, and inversion to a color on its
+// way to the device, in that order.
+func (stk *BlinkStick) correct(channel, r, g, b byte) (byte, byte, byte) {
+	c := stk.process(Color{r, g, b})
+	if stk.isInverse(channel) {
+		c = c.Complement()
+	}
+	return c.R, c.G, c.B
+}
+
+// Appends one LED's color to data in the device's byte order, corrected as needed.
+func (stk *BlinkStick) appendColor(data []byte, channel, r, g, b byte) []byte {
+	c := stk.process(Color{r, g, b})
+	return stk.appendWire(data, channel, c.R, c.G, c.B)
+}
+
+// Appends an already corrected color to data, inverted if the channel is and in the
+// device's byte order.
+func (stk *BlinkStick) appendWire(data []byte, channel, r, g, b byte) []byte {
+	if stk.isInverse(channel) {
+		r, g, b = 255-r, 255-g, 255-b
+	}
+	if stk.RGB {
+		return append(data, r, g, b)
+	}
+	return append(data, g, r, b)
+}
+
+// Reads one LED's color from data in the device's byte order, undoing any inversion the
+// channel it came from has.
+func (stk *BlinkStick) decodeColor(channel byte, data []byte) Color {
+	c := Color{R: data[1], G: data[0], B: data[2]}
+	if stk.RGB {
+		c = Color{R: data[0], G: data[1], B: data[2]}
+	}
+	if stk.isInverse(channel) {
+		c = c.Complement()
+	}
+	return c
+}
+
+// Returns true if a and b differ by no more than tolerance.
+func within(a, b, tolerance byte) bool {
+	if a > b {
+		return a-b <= tolerance
+	}
+	return b-a <= tolerance
+}
+
+// Info blocks lead with their report ID and are padded out with null bytes.
+func infoString(buffer []byte) string {
+	data := buffer[1:]
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return string(data)
+}
+
 // Returns true if the device is a BlinkStick.
 func filterBlinkStick(desc *gousb.DeviceDesc) bool {
 	return desc.Vendor == vendorID && desc.Product == productID
 }
 
 // The BlinkStick seems to use different Report IDs for different data lengths when setting all LEDs.
+//
+// The smallest report the device's report descriptor says will fit is used, falling back
+// on the reports every BlinkStick so far has had if the descriptor couldn't be read.
 func (stk *BlinkStick) getReportID(count int) (uint16, uint16) {
+	if reports := stk.ledReports(); len(reports) > 0 {
+		for _, report := range reports {
+			if count <= int(report.maxLEDs)*3 {
+				return report.id, report.maxLEDs
+			}
+		}
+		largest := reports[len(reports)-1]
+		return largest.id, largest.maxLEDs
+	}
+
 	var reportID uint16
 	var maxLEDs uint16
 
@@ -10,7 +10,14 @@
 
 package blinkstickgo
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/different55/blinkstickgo/testdevice"
+	"github.com/google/gousb"
+)
 
 // Basic usage, setting all LEDs white
 func ExampleBlinkStick() {
@@ -64,4 +71,648 @@ func TestSetRGB(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+// Control transfers as the package makes them, over an already opened device.
+func BenchmarkControl(b *testing.B) {
+	Init()
+	defer Fini()
+
+	sticks, err := FindAll()
+	if err != nil {
+		panic(err)
+	} else if len(sticks) == 0 {
+		panic("No connected BlinkStick devices for testing")
+	}
+
+	buffer := make([]byte, 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := sticks[0].control(0x80|0x20, 0x01, 0x81, 0x00, buffer)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Control transfers with the interface claimed and released around each one, for comparison.
+func BenchmarkControlClaimPerCall(b *testing.B) {
+	Init()
+	defer Fini()
+
+	sticks, err := FindAll()
+	if err != nil {
+		panic(err)
+	} else if len(sticks) == 0 {
+		panic("No connected BlinkStick devices for testing")
+	}
+
+	device := sticks[0].Device.(*gousb.Device)
+	device.SetAutoDetach(true) // Claiming fails while the kernel's HID driver holds it.
+	buffer := make([]byte, 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg, err := device.Config(1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		intf, err := cfg.Interface(0, 0)
+		if err != nil {
+			cfg.Close()
+			b.Fatal(err)
+		}
+
+		err = sticks[0].control(0x80|0x20, 0x01, 0x81, 0x00, buffer)
+		intf.Close()
+		cfg.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGetChannelLEDData(t *testing.T) {
+	Init()
+	defer Fini()
+
+	sticks, err := FindAll()
+	if err != nil {
+		panic(err)
+	}
+
+	tested := false
+	for _, stick := range sticks {
+		if stick.ChannelCount() < 2 {
+			continue
+		}
+		tested = true
+
+		colors := []Color{{255, 0, 0}, {0, 0, 255}}
+		for channel, c := range colors {
+			err := stick.SetRGB(byte(channel), 0, c.R, c.G, c.B)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		for channel, c := range colors {
+			recvData, err := stick.GetChannelLEDData(byte(channel), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := stick.decodeColor(byte(channel), recvData)
+			if !within(got.R, c.R, 3) || !within(got.G, c.G, 3) || !within(got.B, c.B, 3) {
+				t.Errorf("channel %d read back %v, want %v", channel, got, c)
+			}
+		}
+	}
+
+	if !tested {
+		t.Skip("No connected multi-channel BlinkStick devices for testing")
+	}
+}
+
+func TestPackFrame(t *testing.T) {
+	pixels := []Color{{255, 0, 0}, {0, 255, 0}, {1, 2, 3}}
+
+	var grb BlinkStick
+	data := grb.PackFrame(pixels)
+	if want := []byte{0, 255, 0, 255, 0, 0, 2, 1, 3}; string(data) != string(want) {
+		t.Errorf("GRB PackFrame = %v, want %v", data, want)
+	}
+
+	rgb := BlinkStick{RGB: true, Inverse: true}
+	data = rgb.PackFrame(pixels)
+	if want := []byte{0, 255, 255, 255, 0, 255, 254, 253, 252}; string(data) != string(want) {
+		t.Errorf("inverse RGB PackFrame = %v, want %v", data, want)
+	}
+
+	for _, stk := range []BlinkStick{grb, rgb} {
+		got := stk.UnpackFrame(stk.PackFrame(pixels))
+		for i := range pixels {
+			if got[i] != pixels[i] {
+				t.Errorf("UnpackFrame(PackFrame(%v)) = %v", pixels, got)
+				break
+			}
+		}
+	}
+}
+
+func TestNanoLEDs(t *testing.T) {
+	Init()
+	defer Fini()
+
+	sticks, err := FindAll()
+	if err != nil {
+		panic(err)
+	}
+
+	tested := false
+	for _, stick := range sticks {
+		if stick.GetVariant() != VariantNano {
+			continue
+		}
+		tested = true
+
+		err := stick.SetAllRGB(0, 255, 255, 255)
+		if err != nil {
+			panic(err)
+		}
+
+		recvData, err := stick.GetLEDData(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range recvData {
+			if chunk < 252 {
+				t.Errorf("Nano LED data %v, want both LEDs white", recvData)
+				break
+			}
+		}
+	}
+
+	if !tested {
+		t.Skip("No connected BlinkStick Nano devices for testing")
+	}
+}
+
+func TestSetAllRGBNFake(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if v := stk.GetVariant(); v != VariantStrip {
+		t.Fatalf("GetVariant() = %v, want %v", v, VariantStrip)
+	}
+
+	if err := stk.SetAllRGBN(0, 2, 10, 20, 30); err != nil {
+		t.Fatal(err)
+	}
+	writes := device.Writes()
+	if len(writes) != 1 {
+		t.Fatalf("SetAllRGBN made writes %v, want one", writes)
+	}
+	want := make([]byte, 2+8*3)
+	copy(want[2:], []byte{20, 10, 30, 20, 10, 30})
+	if w := writes[0]; w.Value != 6 || string(w.Data) != string(want) {
+		t.Errorf("SetAllRGBN wrote %v, want report 6 with %v", w, want)
+	}
+
+	data, err := stk.GetLEDData(2)
+	if err != nil || string(data) != string(want[2:8]) {
+		t.Errorf("GetLEDData(2) = %v, %v, want %v", data, err, want[2:8])
+	}
+}
+
+func TestTrySetAll(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.GetLEDCount()
+
+	// Hold a whole frame up in the middle of its transfer.
+	device.Block()
+	done := make(chan error)
+	go func() { done <- stk.SetAllRGB(0, 0, 0, 255) }()
+	for device.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	ok, err := stk.TrySetAll(0, Color{255, 0, 0})
+	if ok || err != nil {
+		t.Errorf("TrySetAll on a busy device = %v, %v, want false, nil", ok, err)
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("TrySetAll on a busy device waited %v", waited)
+	}
+	if stats := stk.Stats(); stats.TransfersFailed != 0 {
+		t.Errorf("TrySetAll on a busy device counted %d failed transfers", stats.TransfersFailed)
+	}
+
+	device.Unblock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if writes := device.Writes(); len(writes) != 1 {
+		t.Errorf("TrySetAll on a busy device wrote %v, want just the held up frame", writes)
+	}
+
+	ok, err = stk.TrySetAll(0, Color{255, 0, 0})
+	if !ok || err != nil {
+		t.Errorf("TrySetAll = %v, %v, want true, nil", ok, err)
+	}
+	if writes := device.Writes(); len(writes) != 2 {
+		t.Errorf("TrySetAll made writes %v, want one more", writes)
+	}
+}
+
+func TestProLEDData(t *testing.T) {
+	Init()
+	defer Fini()
+
+	sticks, err := FindAll()
+	if err != nil {
+		panic(err)
+	}
+
+	tested := false
+	for _, stick := range sticks {
+		if stick.GetVariant() != VariantPro {
+			continue
+		}
+		tested = true
+
+		err := stick.SetRGB(0, 0, 255, 0, 0)
+		if err != nil {
+			panic(err)
+		}
+
+		recvData, err := stick.GetLEDData(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := stick.decodeColor(0, recvData); c.R < 252 || c.G > 3 || c.B > 3 {
+			t.Errorf("Pro LED data %v decodes to %v, want red", recvData, c)
+		}
+		stick.Off(0)
+	}
+
+	if !tested {
+		t.Skip("No connected BlinkStick Pro devices for testing")
+	}
+}
+
+func TestSetReversed(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetReversed(true)
+
+	if err := stk.SetRGB(0, 0, 255, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	writes := device.Writes()
+	if len(writes) != 1 || writes[0].Value != 5 || writes[0].Data[2] != 7 {
+		t.Fatalf("reversed SetRGB(0) made writes %v, want LED 7 set with report 5", writes)
+	}
+
+	device.Reset()
+	if err := stk.SetLEDData(0, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	writes = device.Writes()
+	if data := writes[0].Data[2:]; string(data[:21]) != string(make([]byte, 21)) || string(data[21:24]) != "\x02\x01\x03" {
+		t.Errorf("reversed SetLEDData wrote %v, want just the last LED set", data)
+	}
+
+	data, err := stk.GetLEDData(1)
+	if err != nil || string(data) != "\x02\x01\x03" {
+		t.Errorf("reversed GetLEDData(1) = %v, %v, want [2 1 3]", data, err)
+	}
+}
+
+func TestSetInverseChannel(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.Inverse = true
+	stk.SetInverseChannel(1, false)
+
+	if err := stk.SetRGB(0, 0, 255, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.SetRGB(1, 0, 255, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	writes := device.Writes()
+	if data := writes[0].Data; string(data) != "\x00\x00\xff\xff" {
+		t.Errorf("SetRGB on inverted channel 0 wrote %v, want [0 0 255 255]", data)
+	}
+	if data := writes[1].Data; string(data) != "\x05\x01\x00\xff\x00\x00" {
+		t.Errorf("SetRGB on channel 1 wrote %v, want [5 1 0 255 0 0]", data)
+	}
+}
+
+func TestSetRingOffset(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetRingOffset(6)
+
+	for index, want := range map[byte]byte{0: 6, 1: 7, 2: 0, 7: 5} {
+		device.Reset()
+		if err := stk.SetRGB(0, index, 255, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+		if writes := device.Writes(); writes[0].Data[2] != want {
+			t.Errorf("SetRGB(%d) with offset 6 set LED %d, want %d", index, writes[0].Data[2], want)
+		}
+	}
+
+	device.Reset()
+	if err := stk.SetLEDData(0, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}); err != nil {
+		t.Fatal(err)
+	}
+	data := device.Writes()[0].Data[2:]
+	if string(data[18:24]) != "\x02\x01\x03\x05\x04\x06" || string(data[0:3]) != "\x08\x07\x09" {
+		t.Errorf("SetLEDData with offset 6 wrote %v, want the third LED wrapped around to the start", data)
+	}
+	if got, err := stk.GetLEDData(3); err != nil || string(got) != string(data[18:24])+string(data[:3]) {
+		t.Errorf("GetLEDData(3) with offset 6 = %v, %v, want it read back from the same LEDs", got, err)
+	}
+
+	stk.SetRingOffset(-2)
+	stk.SetReversed(true)
+	if stk.physicalIndex(0) != 5 || stk.physicalIndex(6) != 7 {
+		t.Errorf("reversed with offset -2, indexes 0 and 6 map to %d and %d, want 5 and 7", stk.physicalIndex(0), stk.physicalIndex(6))
+	}
+}
+
+func TestZones(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	if err := stk.DefineZone("left", 0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.DefineZone("right", 4, 8); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.DefineZone("middle", 2, 6); err == nil {
+		t.Error("DefineZone allowed overlapping zones")
+	}
+	if err := stk.DefineZone("beyond", 8, 9); err == nil {
+		t.Error("DefineZone allowed a zone past the end of the strip")
+	}
+
+	red, blue := Color{255, 0, 0}, Color{0, 0, 255}
+	if err := stk.ZoneSetAll("left", red); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.ZoneSetAll("right", blue); err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := stk.LastFrame(0)
+	for i, c := range frame.Pixels {
+		want := blue
+		if i < 4 {
+			want = red
+		}
+		if c != want {
+			t.Errorf("LED %d = %v, want %v", i, c, want)
+		}
+	}
+
+	if err := stk.ZoneSetAll("nowhere", red); err == nil {
+		t.Error("ZoneSetAll allowed an unknown zone")
+	}
+}
+
+func TestSetRGBW(t *testing.T) {
+	device := testdevice.New()
+	device.Release = 0x0203
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	if err := stk.SetRGBW(0, 0, 1, 2, 3, 4); err == nil {
+		t.Error("SetRGBW worked without the RGBW field set")
+	}
+
+	stk.RGBW = true
+	if err := stk.SetLEDData(0, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.SetRGBW(0, 1, 5, 6, 7, 8); err != nil {
+		t.Fatal(err)
+	}
+	writes := device.Writes()
+	if data := writes[len(writes)-1].Data[2:10]; string(data) != "\x02\x01\x03\x04\x06\x05\x07\x08" {
+		t.Errorf("SetRGBW wrote %v, want GRBW pixels", data)
+	}
+
+	strip := NewBlinkStick(testdevice.New(), "BS000001-3.0")
+	strip.RGBW = true
+	if err := strip.SetRGBW(0, 0, 1, 2, 3, 4); err != ErrUnsupported {
+		t.Errorf("SetRGBW on a Strip = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestSetIfChanged(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if err := stk.SetAllRGB(0, 100, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	device.Reset()
+
+	if wrote, err := stk.SetIfChanged(0, 3, Color{102, 98, 100}, 2); wrote || err != nil {
+		t.Errorf("SetIfChanged within the threshold = %v, %v, want false, nil", wrote, err)
+	}
+	if wrote, err := stk.SetIfChanged(0, 3, Color{103, 100, 100}, 2); !wrote || err != nil {
+		t.Errorf("SetIfChanged past the threshold = %v, %v, want true, nil", wrote, err)
+	}
+	if wrote, _ := stk.SetIfChanged(0, 3, Color{104, 100, 100}, 2); wrote {
+		t.Error("SetIfChanged didn't compare against the color it last wrote")
+	}
+	if writes := device.Writes(); len(writes) != 1 {
+		t.Errorf("SetIfChanged made writes %v, want one", writes)
+	}
+}
+
+// A device that accepts every transfer and does nothing, for benchmarking the package's
+// own overhead.
+type nullDevice struct{}
+
+func (nullDevice) Control(requestType, request uint8, val, idx uint16, data []byte) (int, error) {
+	if val == 0x81 && len(data) > 1 {
+		data[1] = 64
+	}
+	return len(data), nil
+}
+func (nullDevice) Product() (string, error)      { return "", nil }
+func (nullDevice) Manufacturer() (string, error) { return "", nil }
+func (nullDevice) Close() error                  { return nil }
+
+func BenchmarkSetAllRGB(b *testing.B) {
+	stk := NewBlinkStick(nullDevice{}, "BS000001-3.0")
+	stk.SetAllRGB(0, 0, 0, 0) // Read the LED count and report descriptor out of the way.
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := stk.SetAllRGB(0, byte(i), 128, 255)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	config, err := stk.ReadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Variant != VariantStrip || config.LEDCount != 8 || config.Serial != "BS000001-3.0" {
+		t.Errorf("ReadConfig = %+v, want an 8 LED Strip", config)
+	}
+
+	failing := NewBlinkStick(testdevice.New(), "BS000001-3.0")
+	failing.Device.(*testdevice.Device).SetError(errors.New("unplugged"))
+	config, err = failing.ReadConfig()
+	if err == nil {
+		t.Error("ReadConfig didn't report any failures")
+	}
+	if config.Serial != "BS000001-3.0" || config.LEDCount != -1 {
+		t.Errorf("ReadConfig with every read failing = %+v, want the serial and no LED count", config)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	defer stk.DisableWatchdog()
+
+	stk.EnableWatchdog(50 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		if err := stk.SetAllRGB(0, 255, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if writes := device.Writes(); len(writes) != 4 {
+		t.Fatalf("watchdog fired while the stick was being written to, writes = %v", writes)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	writes := device.Writes()
+	if len(writes) != 5 || string(writes[4].Data[2:]) != string(make([]byte, 24)) {
+		t.Fatalf("watchdog left writes %v, want one more turning the strip off", writes)
+	}
+}
+
+func TestWatchdogInverse(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	defer stk.DisableWatchdog()
+
+	stk.EnableWatchdog(50 * time.Millisecond)
+	stk.Inverse = true
+	if err := stk.SetAllRGB(0, 255, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	writes := device.Writes()
+	off := make([]byte, 24)
+	for i := range off {
+		off[i] = 255
+	}
+	if len(writes) != 2 || string(writes[1].Data[2:]) != string(off) {
+		t.Fatalf("watchdog left writes %v, want one more turning the inverse strip off", writes)
+	}
+}
+
+func TestSerialWarnings(t *testing.T) {
+	sticks := []BlinkStick{
+		*NewBlinkStick(testdevice.New(), "BS000001-3.0"),
+		*NewBlinkStick(testdevice.New(), "BS000002-3.0"),
+		*NewBlinkStick(testdevice.New(), "BS000001-3.0"),
+		*NewBlinkStick(testdevice.New(), ""),
+	}
+
+	warnings := serialWarnings(sticks)
+	want := []SerialWarning{
+		{Serial: "BS000001-3.0", Problem: SerialDuplicate},
+		{Serial: "BS000001-3.0", Problem: SerialDuplicate},
+		{Serial: "", Problem: SerialBlank},
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("serialWarnings = %v, want %v", warnings, want)
+	}
+	for i := range want {
+		if warnings[i] != want[i] {
+			t.Errorf("serialWarnings[%d] = %v, want %v", i, warnings[i], want[i])
+		}
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	Fini()
+	Fini() // Twice over shouldn't panic either.
+
+	if _, err := FindAll(); err != ErrNotInitialized {
+		t.Errorf("FindAll after Fini = %v, want %v", err, ErrNotInitialized)
+	}
+	if _, err := IsPresent("BS000001-3.0"); err != ErrNotInitialized {
+		t.Errorf("IsPresent after Fini = %v, want %v", err, ErrNotInitialized)
+	}
+}
+
+func TestCalibrateColorOrder(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.RGB = true
+
+	// Stand in for the firmware putting the red in GRB order.
+	device.Control(0x20, 0x09, 0x06, 0x00, []byte{0, 0, 0, 255, 0})
+	if err := stk.CalibrateColorOrder(); err != nil {
+		t.Fatal(err)
+	}
+	if stk.RGB {
+		t.Error("CalibrateColorOrder kept RGB for a stick that sent back GRB")
+	}
+
+	device.Control(0x20, 0x09, 0x06, 0x00, []byte{0, 0, 0, 0, 0})
+	if err := stk.CalibrateColorOrder(); err == nil {
+		t.Error("CalibrateColorOrder with no red read back succeeded")
+	}
+	writes := device.Writes()
+	if off := writes[len(writes)-1]; off.Value != 1 || string(off.Data) != "\x00\x00\x00\x00" {
+		t.Errorf("CalibrateColorOrder failing left its last write as %v, want the LED off", off)
+	}
+
+	original := NewBlinkStick(testdevice.New(), "BS000001-1.0")
+	if err := original.CalibrateColorOrder(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("CalibrateColorOrder on the original BlinkStick = %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestTemporalDitherSettings(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetTemporalDitherRate(500)
+	stk.EnableTemporalDither(true)
+	defer stk.EnableTemporalDither(false)
+
+	// Changed after dithering started, so the redraws have to pick it up from the write.
+	stk.SetBrightness(0.1)
+	if err := stk.SetAllRGB(0, 200, 200, 200); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	stk.EnableTemporalDither(false)
+
+	writes := device.Writes()
+	if len(writes) < 3 {
+		t.Fatalf("dithering made writes %v, want some redraws", writes)
+	}
+	for _, w := range writes {
+		for _, v := range w.Data[2:26] {
+			if v > 21 {
+				t.Fatalf("dithering at brightness 0.1 wrote %v", w.Data)
+			}
+		}
+	}
+}
+
+func TestLEDDataBounds(t *testing.T) {
+	stk := NewBlinkStick(testdevice.New(), "BS000001-3.0")
+	for _, count := range []int{-1, 65, 100} {
+		if _, err := stk.GetLEDData(count); err == nil {
+			t.Errorf("GetLEDData(%d) didn't fail", count)
+		}
+		if _, err := stk.GetChannelLEDData(0, count); err == nil {
+			t.Errorf("GetChannelLEDData(0, %d) didn't fail", count)
+		}
+	}
+	if data, err := stk.GetLEDData(64); err != nil || len(data) != 64*3 {
+		t.Errorf("GetLEDData(64) = %d bytes, %v, want %d", len(data), err, 64*3)
+	}
+}
@@ -0,0 +1,84 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * cache.go
+ */
+
+package blinkstickgo
+
+import (
+	"sync"
+	"time"
+)
+
+// The sticks FindAllCached last found, and when.
+var discovery struct {
+	mu     sync.Mutex
+	sticks []BlinkStick
+	found  time.Time
+	valid  bool
+}
+
+// FindAllCached is like FindAll, but only scans for BlinkSticks if it hasn't in the last
+// ttl, for services that check what's plugged in often. Scanning opens every device,
+// which is slow and can disturb whatever else is using them.
+//
+// The same, still open sticks are returned every time. When it does scan, sticks that
+// were found before are kept rather than opened again, as long as they still answer.
+// Those that don't, say after being unplugged and plugged back in, are closed and
+// replaced by the new handle, and any that have gone away are closed. Sticks from it
+// shouldn't be closed by hand, since they'd stay in the cache.
+func FindAllCached(ttl time.Duration) ([]BlinkStick, error) {
+	discovery.mu.Lock()
+	defer discovery.mu.Unlock()
+	if discovery.valid && time.Since(discovery.found) < ttl {
+		return append([]BlinkStick(nil), discovery.sticks...), nil
+	}
+
+	found, err := FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sticks with blank or shared serials can't be told apart, so each old stick is
+	// matched to at most one new one, and whatever's left over is closed.
+	old := append([]BlinkStick(nil), discovery.sticks...)
+	sticks := make([]BlinkStick, 0, len(found))
+	for _, stk := range found {
+		for i := range old {
+			if stk.Serial == "" || old[i].Serial != stk.Serial {
+				continue
+			}
+			if old[i].IsAlive() {
+				stk.Device.Close()
+				stk = old[i]
+			} else {
+				old[i].Close()
+			}
+			old = append(old[:i], old[i+1:]...)
+			break
+		}
+		sticks = append(sticks, stk)
+	}
+	for _, stk := range old {
+		stk.Close()
+	}
+
+	discovery.sticks = sticks
+	discovery.found = time.Now()
+	discovery.valid = true
+	return append([]BlinkStick(nil), sticks...), nil
+}
+
+// InvalidateCache makes the next FindAllCached scan for BlinkSticks again, for when
+// something's known to have been plugged in or unplugged. The cached sticks aren't
+// closed; the scan keeps any that are still there.
+func InvalidateCache() {
+	discovery.mu.Lock()
+	discovery.valid = false
+	discovery.mu.Unlock()
+}
@@ -0,0 +1,407 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * color.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Color represents the color of a single LED in RGB format.
+type Color struct {
+	R, G, B byte
+}
+
+// Colors holds the named colors understood by ColorByName, using the basic CSS names.
+var Colors = map[string]Color{
+	"black":   {0, 0, 0},
+	"silver":  {192, 192, 192},
+	"gray":    {128, 128, 128},
+	"white":   {255, 255, 255},
+	"maroon":  {128, 0, 0},
+	"red":     {255, 0, 0},
+	"purple":  {128, 0, 128},
+	"fuchsia": {255, 0, 255},
+	"magenta": {255, 0, 255},
+	"green":   {0, 128, 0},
+	"lime":    {0, 255, 0},
+	"olive":   {128, 128, 0},
+	"yellow":  {255, 255, 0},
+	"navy":    {0, 0, 128},
+	"blue":    {0, 0, 255},
+	"teal":    {0, 128, 128},
+	"aqua":    {0, 255, 255},
+	"cyan":    {0, 255, 255},
+	"orange":  {255, 165, 0},
+	"pink":    {255, 192, 203},
+	"brown":   {165, 42, 42},
+	"gold":    {255, 215, 0},
+	"indigo":  {75, 0, 130},
+	"violet":  {238, 130, 238},
+}
+
+// ColorByName looks up a color in Colors, ignoring case.
+func ColorByName(name string) (Color, bool) {
+	c, ok := Colors[strings.ToLower(name)]
+	return c, ok
+}
+
+// MixColors linearly interpolates between two colors, where t runs from 0 (all a) to
+// 1 (all b). It's clamped to that range.
+func MixColors(a, b Color, t float64) Color {
+	t = math.Max(0, math.Min(1, t))
+	mix := func(x, y byte) byte {
+		return byte(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return Color{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B)}
+}
+
+// Lerp is MixColors as a method, running from c at 0 to other at 1.
+func (c Color) Lerp(other Color, t float64) Color {
+	return MixColors(c, other, t)
+}
+
+// Complement returns the opposite color, with every channel flipped.
+func (c Color) Complement() Color {
+	return Color{R: 255 - c.R, G: 255 - c.G, B: 255 - c.B}
+}
+
+// Scale multiplies every channel by factor. Factors below 1 dim the color and above 1
+// brighten it, with each channel topping out at 255 and negative factors giving black.
+func (c Color) Scale(factor float64) Color {
+	factor = math.Max(0, factor)
+	scale := func(x byte) byte {
+		return byte(math.Min(255, math.Round(float64(x)*factor)))
+	}
+	return Color{R: scale(c.R), G: scale(c.G), B: scale(c.B)}
+}
+
+// Luminance returns how bright the color looks, from 0 to 1, weighting each channel by the
+// eye's sensitivity to it (Rec. 709). Over 0.5 or so, black text reads better on it than
+// white.
+func (c Color) Luminance() float64 {
+	return (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+}
+
+// ToHSV returns the color's hue in degrees, from 0 up to 360, and its saturation and value
+// from 0 to 1.
+func (c Color) ToHSV() (h, s, v float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	v = max
+	if max > 0 {
+		s = delta / max
+	}
+	switch {
+	case delta == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case max == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// FromHSV returns the color with the given hue in degrees, which wraps around, and
+// saturation and value from 0 to 1, which are clamped.
+func FromHSV(h, s, v float64) Color {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	s = math.Max(0, math.Min(1, s))
+	v = math.Max(0, math.Min(1, v))
+
+	chroma := v * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g = chroma, x
+	case h < 120:
+		r, g = x, chroma
+	case h < 180:
+		g, b = chroma, x
+	case h < 240:
+		g, b = x, chroma
+	case h < 300:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+
+	m := v - chroma
+	channel := func(x float64) byte {
+		return byte(math.Round(255 * (x + m)))
+	}
+	return Color{R: channel(r), G: channel(g), B: channel(b)}
+}
+
+// FromHSL returns the color with the given hue in degrees, which wraps around, and
+// saturation and lightness from 0 to 1, which are clamped. Unlike HSV's value, lightness
+// runs from black through the pure hue at 0.5 up to white, which makes pastels and dark
+// shades easier to pick. With no saturation, it's a gray.
+func FromHSL(h, s, l float64) Color {
+	s = math.Max(0, math.Min(1, s))
+	l = math.Max(0, math.Min(1, l))
+
+	v := l + s*math.Min(l, 1-l)
+	if v == 0 {
+		return Color{}
+	}
+	return FromHSV(h, 2*(1-l/v), v)
+}
+
+// SetHSV sets one LED to a color given as hue, saturation, and value, like FromHSV.
+func (stk *BlinkStick) SetHSV(channel, index byte, h, s, v float64) error {
+	c := FromHSV(h, s, v)
+	return stk.SetRGB(channel, index, c.R, c.G, c.B)
+}
+
+// SetHSL sets one LED to a color given as hue, saturation, and lightness, like FromHSL.
+func (stk *BlinkStick) SetHSL(channel, index byte, h, s, l float64) error {
+	c := FromHSL(h, s, l)
+	return stk.SetRGB(channel, index, c.R, c.G, c.B)
+}
+
+// SetAllHSL sets every LED on a channel to a color given as hue, saturation, and
+// lightness, like FromHSL.
+func (stk *BlinkStick) SetAllHSL(channel byte, h, s, l float64) error {
+	c := FromHSL(h, s, l)
+	return stk.SetAllRGB(channel, c.R, c.G, c.B)
+}
+
+// ColorFromKelvin returns the color of white light at a color temperature, from a warm
+// 1000K candle glow up to a cold 40000K blue sky. It's clamped to that range. Daylight is
+// around 6500K, where the result is close to pure white.
+//
+// It uses Tanner Helland's curve fit to blackbody radiation, which is only approximate
+// but plenty for lighting.
+func ColorFromKelvin(kelvin float64) Color {
+	t := math.Max(1000, math.Min(40000, kelvin)) / 100
+	clamp := func(x float64) byte {
+		return byte(math.Round(math.Max(0, math.Min(255, x))))
+	}
+
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	return Color{R: clamp(r), G: clamp(g), B: clamp(b)}
+}
+
+// SetWhite sets one LED to white at a color temperature, like ColorFromKelvin, and a
+// brightness from 0 to 1, for standing in for a tunable white bulb.
+func (stk *BlinkStick) SetWhite(channel, index byte, kelvin, brightness float64) error {
+	c := ColorFromKelvin(kelvin).Scale(math.Max(0, math.Min(1, brightness)))
+	return stk.SetRGB(channel, index, c.R, c.G, c.B)
+}
+
+// BlendOver lays top over base with the given opacity, from 0 (just base) to 1 (just top).
+func BlendOver(base, top Color, alpha float64) Color {
+	return MixColors(base, top, alpha)
+}
+
+// Overlay blends a frame over whatever a channel is showing now, with a separate opacity
+// for each LED, and writes the result back. LEDs past the end of top are left as they are.
+//
+// What's showing comes from LastFrame, or is read from the device if there isn't one.
+func (stk *BlinkStick) Overlay(channel byte, top []Color, alpha []float64) error {
+	if len(alpha) != len(top) {
+		return fmt.Errorf("%d alphas given for %d colors", len(alpha), len(top))
+	}
+
+	frame, err := stk.currentFrame(channel)
+	if err != nil {
+		return err
+	}
+
+	pixels := frame.Pixels
+	for len(pixels) < len(top) {
+		pixels = append(pixels, Color{})
+	}
+	for i := range top {
+		pixels[i] = BlendOver(pixels[i], top[i], alpha[i])
+	}
+	return stk.writeFrame(channel, pixels)
+}
+
+// SetBrightness scales every color written to the device, from 0 (off) to 1 (full).
+func (stk *BlinkStick) SetBrightness(brightness float64) {
+	stk.dim = 1 - math.Max(0, math.Min(1, brightness))
+}
+
+// Applies the brightness setting to a color.
+func (stk *BlinkStick) applyBrightness(c Color) Color {
+	if stk.dim == 0 {
+		return c
+	}
+	return c.Scale(1 - stk.dim)
+}
+
+// SetGamma applies the same gamma correction to all three color channels on write.
+//
+// A gamma of 1 disables correction. Values around 2.2 tend to make fades look more even.
+func (stk *BlinkStick) SetGamma(g float64) {
+	stk.SetGammaRGB(g, g, g)
+}
+
+// SetGammaRGB applies an independent gamma correction to each color channel on write.
+//
+// LEDs are rarely equally efficient at every color, so tuning each channel separately
+// can balance out a strip's whites.
+func (stk *BlinkStick) SetGammaRGB(gr, gg, gb float64) {
+	if gr == 1 && gg == 1 && gb == 1 {
+		stk.gamma = nil
+		return
+	}
+	stk.gamma = &gammaCorrection{
+		exponents: [3]float64{gr, gg, gb},
+		tables:    [3][256]byte{gammaTable(gr), gammaTable(gg), gammaTable(gb)},
+	}
+}
+
+// A gamma setting, along with lookup tables for applying it quickly.
+type gammaCorrection struct {
+	exponents [3]float64
+	tables    [3][256]byte
+}
+
+// Applies the gamma tables, if any, to a color.
+func (stk *BlinkStick) applyGamma(c Color) Color {
+	if stk.gamma == nil {
+		return c
+	}
+	return Color{R: stk.gamma.tables[0][c.R], G: stk.gamma.tables[1][c.G], B: stk.gamma.tables[2][c.B]}
+}
+
+// Color correction presets for SetColorCorrection, matching FastLED's.
+var (
+	UncorrectedColor   = [3]float64{1, 1, 1}
+	TypicalLEDStrip    = [3]float64{1, 176.0 / 255, 240.0 / 255} // Most 5050 SMD strips.
+	TypicalPixelString = [3]float64{1, 224.0 / 255, 140.0 / 255} // 8mm through-hole pixel strings.
+)
+
+// SetColorCorrection scales each color channel by a fixed multiplier on write, from 0 to
+// 1, to take out the color cast a lot of LEDs have and get neutral whites.
+//
+// Correction is applied after gamma. Pass UncorrectedColor to turn it off.
+func (stk *BlinkStick) SetColorCorrection(corr [3]float64) {
+	if corr == UncorrectedColor {
+		stk.balance = nil
+		return
+	}
+	for i := range corr {
+		corr[i] = math.Max(0, math.Min(1, corr[i]))
+	}
+	stk.balance = &corr
+}
+
+// Applies the color correction, if any, to a color.
+func (stk *BlinkStick) applyCorrection(c Color) Color {
+	if stk.balance == nil {
+		return c
+	}
+	return Color{
+		R: byte(math.Round(float64(c.R) * stk.balance[0])),
+		G: byte(math.Round(float64(c.G) * stk.balance[1])),
+		B: byte(math.Round(float64(c.B) * stk.balance[2])),
+	}
+}
+
+// SetFilter runs every color written to the device through f, for theming all of the
+// lights at once, like NightMode. Passing nil clears it.
+//
+// Colors go through brightness, then gamma, then color correction, then the filter, and
+// are inverted last if the channel is (see SetInverseChannel). Filters work on whole values, so
+// temporal dithering can't smooth out what comes out of one.
+func (stk *BlinkStick) SetFilter(f func(Color) Color) {
+	stk.filter = f
+}
+
+// NightMode is a filter for SetFilter that dims colors and shifts them warm, leaving out
+// most of the blue.
+func NightMode(c Color) Color {
+	return Color{
+		R: byte(math.Round(float64(c.R) * 0.6)),
+		G: byte(math.Round(float64(c.G) * 0.4)),
+		B: byte(math.Round(float64(c.B) * 0.15)),
+	}
+}
+
+// Grayscale is a filter for SetFilter that takes the color out, keeping each color's
+// luminance.
+func Grayscale(c Color) Color {
+	v := byte(math.Round(c.Luminance() * 255))
+	return Color{v, v, v}
+}
+
+// Applies brightness, gamma, color correction, and any filter to a color, in that order.
+func (stk *BlinkStick) process(c Color) Color {
+	c = stk.applyCorrection(stk.applyGamma(stk.applyBrightness(c)))
+	if stk.filter != nil {
+		c = stk.filter(c)
+	}
+	return c
+}
+
+// Applies brightness, gamma, and color correction to a color like correct does, but
+// without rounding, for when the fractions matter. A filter needs whole values, so if
+// there is one the result is rounded and filtered after all.
+func (stk *BlinkStick) correctExact(c Color) [3]float64 {
+	if stk.filter != nil {
+		c = stk.process(c)
+		return [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+	}
+
+	exact := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+	for i := range exact {
+		exact[i] *= 1 - stk.dim
+		if stk.gamma != nil {
+			exact[i] = 255 * math.Pow(exact[i]/255, stk.gamma.exponents[i])
+		}
+		if stk.balance != nil {
+			exact[i] *= stk.balance[i]
+		}
+	}
+	return exact
+}
+
+// Builds a lookup table mapping each byte to its gamma corrected value.
+func gammaTable(g float64) [256]byte {
+	var table [256]byte
+	for i := range table {
+		table[i] = byte(math.Round(255 * math.Pow(float64(i)/255, g)))
+	}
+	return table
+}
@@ -0,0 +1,255 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * color_test.go
+ */
+
+package blinkstickgo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSetGammaRGB(t *testing.T) {
+	var stk BlinkStick
+
+	stk.SetGammaRGB(2.2, 1, 0.5)
+	got := stk.applyGamma(Color{128, 128, 128})
+	if got.R >= 128 || got.G != 128 || got.B <= 128 {
+		t.Errorf("applyGamma(128, 128, 128) = %v, want R darker, G unchanged, B brighter", got)
+	}
+	if black, white := stk.applyGamma(Color{}), stk.applyGamma(Color{255, 255, 255}); black != (Color{}) || white != (Color{255, 255, 255}) {
+		t.Errorf("gamma moved the endpoints: black = %v, white = %v", black, white)
+	}
+
+	stk.SetGamma(1)
+	if stk.gamma != nil {
+		t.Error("SetGamma(1) should disable correction")
+	}
+}
+
+func TestMixColors(t *testing.T) {
+	a, b := Color{0, 100, 200}, Color{200, 100, 0}
+
+	tests := []struct {
+		t    float64
+		want Color
+	}{
+		{0, a},
+		{1, b},
+		{0.5, Color{100, 100, 100}},
+		{-1, a},
+		{2, b},
+	}
+	for _, test := range tests {
+		if got := MixColors(a, b, test.t); got != test.want {
+			t.Errorf("MixColors(%v, %v, %v) = %v, want %v", a, b, test.t, got, test.want)
+		}
+	}
+}
+
+func TestBlendOver(t *testing.T) {
+	base, top := Color{10, 20, 30}, Color{250, 240, 230}
+
+	if got := BlendOver(base, top, 0); got != base {
+		t.Errorf("BlendOver with alpha 0 = %v, want the base %v", got, base)
+	}
+	if got := BlendOver(base, top, 1); got != top {
+		t.Errorf("BlendOver with alpha 1 = %v, want the top %v", got, top)
+	}
+}
+
+func TestSetColorCorrection(t *testing.T) {
+	stk := &BlinkStick{}
+	stk.SetColorCorrection(TypicalLEDStrip)
+	if got, want := stk.applyCorrection(Color{255, 255, 255}), (Color{255, 176, 240}); got != want {
+		t.Errorf("applyCorrection(white) = %v, want %v", got, want)
+	}
+
+	stk.SetGamma(2.2)
+	r, g, b := stk.correct(0, 128, 128, 128)
+	if gamma := stk.applyGamma(Color{128, 128, 128}); r != gamma.R || g >= gamma.G || b >= gamma.B {
+		t.Errorf("correct(128, 128, 128) = %d, %d, %d, want correction after gamma %v", r, g, b, gamma)
+	}
+
+	stk.SetColorCorrection(UncorrectedColor)
+	if stk.balance != nil {
+		t.Error("SetColorCorrection(UncorrectedColor) left correction enabled")
+	}
+}
+
+func TestColorMath(t *testing.T) {
+	c := Color{200, 100, 0}
+
+	if got, want := c.Lerp(Color{0, 100, 200}, 0.5), (Color{100, 100, 100}); got != want {
+		t.Errorf("Lerp = %v, want %v", got, want)
+	}
+	if got, want := c.Complement(), (Color{55, 155, 255}); got != want {
+		t.Errorf("Complement = %v, want %v", got, want)
+	}
+	if got, want := c.Scale(0.5), (Color{100, 50, 0}); got != want {
+		t.Errorf("Scale(0.5) = %v, want %v", got, want)
+	}
+	if got, want := c.Scale(2), (Color{255, 200, 0}); got != want {
+		t.Errorf("Scale(2) = %v, want %v", got, want)
+	}
+	if got := c.Scale(-1); got != (Color{}) {
+		t.Errorf("Scale(-1) = %v, want black", got)
+	}
+
+	if l := (Color{255, 255, 255}).Luminance(); math.Abs(l-1) > 1e-9 {
+		t.Errorf("white Luminance = %v, want 1", l)
+	}
+	if green, blue := (Color{0, 255, 0}).Luminance(), (Color{0, 0, 255}).Luminance(); green <= blue {
+		t.Errorf("green Luminance %v isn't above blue's %v", green, blue)
+	}
+}
+
+func TestHSV(t *testing.T) {
+	tests := []struct {
+		c       Color
+		h, s, v float64
+	}{
+		{Color{255, 0, 0}, 0, 1, 1},
+		{Color{0, 255, 0}, 120, 1, 1},
+		{Color{0, 0, 255}, 240, 1, 1},
+		{Color{255, 0, 255}, 300, 1, 1},
+		{Color{128, 128, 128}, 0, 0, 128.0 / 255},
+		{Color{}, 0, 0, 0},
+	}
+	for _, test := range tests {
+		h, s, v := test.c.ToHSV()
+		if math.Abs(h-test.h) > 1e-9 || math.Abs(s-test.s) > 1e-9 || math.Abs(v-test.v) > 1e-9 {
+			t.Errorf("%v.ToHSV() = %v, %v, %v, want %v, %v, %v", test.c, h, s, v, test.h, test.s, test.v)
+		}
+		if got := FromHSV(test.h, test.s, test.v); got != test.c {
+			t.Errorf("FromHSV(%v, %v, %v) = %v, want %v", test.h, test.s, test.v, got, test.c)
+		}
+	}
+
+	for _, c := range []Color{{12, 200, 99}, {250, 128, 3}, {1, 2, 3}} {
+		if got := FromHSV(c.ToHSV()); got != c {
+			t.Errorf("FromHSV(%v.ToHSV()) = %v", c, got)
+		}
+	}
+	if got, want := FromHSV(-120, 1, 1), (Color{0, 0, 255}); got != want {
+		t.Errorf("FromHSV(-120, 1, 1) = %v, want %v", got, want)
+	}
+}
+
+func TestFromHSL(t *testing.T) {
+	tests := []struct {
+		h, s, l float64
+		want    Color
+	}{
+		{0, 1, 0.5, FromHSV(0, 1, 1)},
+		{120, 1, 0.25, FromHSV(120, 1, 0.5)},
+		{240, 1, 0.75, FromHSV(240, 0.5, 1)},
+		{200, 0.5, 0.5, FromHSV(200, 2.0/3, 0.75)},
+		{90, 0, 0.5, Color{128, 128, 128}},
+		{90, 1, 1, Color{255, 255, 255}},
+		{90, 1, 0, Color{}},
+		{30, 2, -1, Color{}},
+	}
+	for _, test := range tests {
+		if got := FromHSL(test.h, test.s, test.l); got != test.want {
+			t.Errorf("FromHSL(%v, %v, %v) = %v, want %v", test.h, test.s, test.l, got, test.want)
+		}
+	}
+}
+
+func TestSetFilter(t *testing.T) {
+	stk := &BlinkStick{Inverse: true}
+	stk.SetBrightness(0.5)
+	stk.SetFilter(Grayscale)
+
+	r, g, b := stk.correct(0, 255, 0, 0)
+	gray := byte(255 - math.Round(0.2126*128))
+	if r != gray || g != gray || b != gray {
+		t.Errorf("correct(255, 0, 0) = %d, %d, %d, want dimmed, grayed, then inverted %d", r, g, b, gray)
+	}
+
+	stk.SetFilter(nil)
+	if r, g, b := stk.correct(0, 255, 0, 0); r != 127 || g != 255 || b != 255 {
+		t.Errorf("correct(255, 0, 0) without a filter = %d, %d, %d, want 127, 255, 255", r, g, b)
+	}
+}
+
+func TestColorFromKelvin(t *testing.T) {
+	candle, daylight, sky := ColorFromKelvin(1900), ColorFromKelvin(6600), ColorFromKelvin(20000)
+	if candle.R != 255 || candle.G >= 160 || candle.B >= 80 {
+		t.Errorf("ColorFromKelvin(1900) = %v, want a warm orange", candle)
+	}
+	if daylight.R < 250 || daylight.G < 245 || daylight.B != 255 {
+		t.Errorf("ColorFromKelvin(6600) = %v, want close to white", daylight)
+	}
+	if sky.B != 255 || sky.R >= sky.B {
+		t.Errorf("ColorFromKelvin(20000) = %v, want a cold blue", sky)
+	}
+	if ColorFromKelvin(0) != ColorFromKelvin(1000) {
+		t.Error("ColorFromKelvin doesn't clamp low temperatures")
+	}
+}
+
+func TestColormapAt(t *testing.T) {
+	if c, ok := ColormapAt("Viridis", 0); !ok || c != (Color{68, 1, 84}) {
+		t.Errorf("ColormapAt(Viridis, 0) = %v, %v, want the first viridis color", c, ok)
+	}
+	if c, _ := ColormapAt("viridis", 2); c != (Color{253, 231, 37}) {
+		t.Errorf("ColormapAt(viridis, 2) = %v, want it clamped to the last color", c)
+	}
+	if c, _ := ColormapAt("inferno", 0.5/9); c != (Color{14, 6, 35}) {
+		t.Errorf("ColormapAt(inferno, 0.5/9) = %v, want halfway between the first two colors", c)
+	}
+	if _, ok := ColormapAt("jet", 0.5); ok {
+		t.Error("ColormapAt found a colormap that doesn't exist")
+	}
+}
+
+func TestParseANSIColor(t *testing.T) {
+	tests := map[string]Color{
+		"\x1b[38;2;255;128;0m": {255, 128, 0},
+		"\x1b[38;5;196m":       {255, 0, 0},
+		"\x1b[1;31m":           {205, 0, 0},
+		"\x1b[44;97m":          {255, 255, 255},
+		"48;5;21":              {0, 0, 255},
+	}
+	for code, want := range tests {
+		if c, err := ParseANSIColor(code); err != nil || c != want {
+			t.Errorf("ParseANSIColor(%q) = %v, %v, want %v", code, c, err, want)
+		}
+	}
+
+	for _, code := range []string{"\x1b[38;2;255m", "\x1b[38;5;256m", "\x1b[31", "\x1b[1m", "red"} {
+		if _, err := ParseANSIColor(code); err == nil {
+			t.Errorf("ParseANSIColor(%q) didn't fail", code)
+		}
+	}
+}
+
+func TestLab(t *testing.T) {
+	for _, c := range []Color{{255, 0, 0}, {0, 255, 0}, {12, 200, 99}, {255, 255, 255}, {}} {
+		if got := FromLab(c.ToLab()); got != c {
+			t.Errorf("FromLab(%v.ToLab()) = %v", c, got)
+		}
+	}
+	if l, a, b := (Color{255, 255, 255}).ToLab(); math.Abs(l-100) > 0.01 || math.Abs(a) > 0.01 || math.Abs(b) > 0.01 {
+		t.Errorf("white in Lab = %v, %v, %v, want 100, 0, 0", l, a, b)
+	}
+
+	// Halfway from red to green, RGB gives a dull olive, while Lab stays brighter.
+	red, green := Color{255, 0, 0}, Color{0, 255, 0}
+	rgb := MixColorsIn(ColorSpaceRGB, red, green, 0.5)
+	lab := MixColorsIn(ColorSpaceLab, red, green, 0.5)
+	if rgb != (Color{128, 128, 0}) {
+		t.Errorf("RGB midpoint = %v, want {128 128 0}", rgb)
+	}
+	if lab.Luminance() <= rgb.Luminance() {
+		t.Errorf("Lab midpoint %v is no brighter than the RGB midpoint %v", lab, rgb)
+	}
+}
@@ -0,0 +1,82 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * colormap.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Colormaps holds the colormaps understood by ColormapAt and SetColormap, matplotlib's
+// perceptually uniform ones. Each is sampled at ten evenly spaced points, with the colors
+// in between interpolated.
+var Colormaps = map[string][]Color{
+	"viridis": {
+		{68, 1, 84}, {72, 40, 120}, {62, 73, 137}, {49, 104, 142}, {38, 130, 142},
+		{31, 158, 137}, {53, 183, 121}, {110, 206, 88}, {181, 222, 43}, {253, 231, 37},
+	},
+	"inferno": {
+		{0, 0, 4}, {27, 12, 65}, {74, 12, 107}, {120, 28, 109}, {165, 44, 96},
+		{207, 68, 70}, {237, 105, 37}, {251, 155, 6}, {247, 209, 61}, {252, 255, 164},
+	},
+	"magma": {
+		{0, 0, 4}, {24, 15, 61}, {68, 15, 118}, {114, 31, 129}, {158, 47, 127},
+		{205, 64, 113}, {241, 96, 93}, {253, 150, 104}, {254, 202, 141}, {252, 253, 191},
+	},
+	"plasma": {
+		{13, 8, 135}, {71, 3, 159}, {115, 1, 168}, {156, 23, 158}, {189, 55, 134},
+		{216, 87, 107}, {237, 121, 83}, {250, 158, 59}, {253, 201, 38}, {240, 249, 33},
+	},
+	"cividis": {
+		{0, 32, 77}, {0, 51, 111}, {57, 72, 107}, {87, 93, 109}, {112, 113, 115},
+		{138, 135, 121}, {166, 157, 117}, {196, 181, 108}, {228, 207, 91}, {255, 234, 70},
+	},
+}
+
+// ColormapAt returns the color a value from 0 to 1 maps to in the named colormap, ignoring
+// case. Values outside that range are clamped. It's false if there's no such colormap.
+func ColormapAt(name string, t float64) (Color, bool) {
+	stops, ok := Colormaps[strings.ToLower(name)]
+	if !ok || len(stops) == 0 {
+		return Color{}, false
+	}
+	return paletteAt(stops, t), true
+}
+
+// Returns the color at t, from 0 to 1, along a palette, blending between its colors.
+// Values outside that range are clamped.
+func paletteAt(palette []Color, t float64) Color {
+	pos := math.Max(0, math.Min(1, t)) * float64(len(palette)-1)
+	i := int(pos)
+	if i >= len(palette)-1 {
+		return palette[len(palette)-1]
+	}
+	return palette[i].Lerp(palette[i+1], pos-float64(i))
+}
+
+// SetColormap spreads the named colormap along a channel, from one end to the other, and
+// writes it in one frame.
+func (stk *BlinkStick) SetColormap(channel byte, name string) error {
+	if _, ok := ColormapAt(name, 0); !ok {
+		return fmt.Errorf("unknown colormap %q", name)
+	}
+
+	count := stk.GetLEDCount()
+	return stk.Fill(channel, func(i int) Color {
+		t := 0.0
+		if count > 1 {
+			t = float64(i) / float64(count-1)
+		}
+		c, _ := ColormapAt(name, t)
+		return c
+	})
+}
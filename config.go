@@ -0,0 +1,59 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * config.go
+ */
+
+package blinkstickgo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Config is everything a BlinkStick can say about how it's set up, as read by ReadConfig.
+type Config struct {
+	Serial   string
+	Variant  Variant
+	Name     string // Info block one, as set with SetName. Empty if it's never been set.
+	Info     string // Info block two, as set with SetInfo. Empty if it's never been set.
+	Mode     Mode   // Only means anything on the Pro; the rest report ModeNormal.
+	LEDCount int    // -1 on the Pro, which can't say how many LEDs it drives.
+}
+
+// ReadConfig reads everything about the device in one go, for diagnostics and support
+// tickets.
+//
+// A read that fails leaves its field at the zero value, or -1 for LEDCount, and the rest
+// are still read. The failures are returned together, after everything else is done.
+func (stk *BlinkStick) ReadConfig() (Config, error) {
+	config := Config{
+		Serial:  stk.Serial,
+		Variant: stk.GetVariant(),
+	}
+
+	var errs []error
+	var err error
+	config.Name, err = stk.readInfoBlock(0x02)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("reading name: %w", err))
+	}
+	config.Info, err = stk.readInfoBlock(0x03)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("reading info: %w", err))
+	}
+	config.Mode, err = stk.GetMode()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("reading mode: %w", err))
+	}
+	config.LEDCount = stk.GetLEDCount()
+	if config.LEDCount < 0 && config.Variant != VariantPro {
+		errs = append(errs, fmt.Errorf("couldn't read the LED count"))
+	}
+
+	return config, errors.Join(errs...)
+}
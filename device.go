@@ -0,0 +1,62 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * device.go
+ */
+
+package blinkstickgo
+
+import (
+	"time"
+
+	"github.com/google/gousb"
+)
+
+// Device is the USB device behind a BlinkStick. FindAll uses *gousb.Device, and the
+// testdevice package has a fake for testing without any hardware.
+//
+// Devices other than *gousb.Device may also have a Revision() uint16 method giving the
+// USB device version, which some variants need to be told apart.
+type Device interface {
+	Control(requestType, request uint8, val, idx uint16, data []byte) (int, error)
+	Product() (string, error)
+	Manufacturer() (string, error)
+	Close() error
+}
+
+// NewBlinkStick wraps an already opened device with the given serial number.
+func NewBlinkStick(device Device, serial string) *BlinkStick {
+	stk := &BlinkStick{
+		Device:  device,
+		Inverse: false, // TODO: The device knows this, right? We should query for it.
+		Serial:  serial,
+		state:   &deviceState{},
+	}
+	stk.RGB = stk.detectRGB()
+	return stk
+}
+
+// Returns the device's USB device version, if it has one.
+func (stk *BlinkStick) revision() (uint16, bool) {
+	switch device := stk.Device.(type) {
+	case *gousb.Device:
+		if device == nil || device.Desc == nil {
+			return 0, false
+		}
+		return uint16(device.Desc.Device), true
+	case interface{ Revision() uint16 }:
+		return device.Revision(), true
+	}
+	return 0, false
+}
+
+// Sets the timeout for the next control transfer, on devices that take one.
+func (stk *BlinkStick) setDeviceTimeout(d time.Duration) {
+	if device, ok := stk.Device.(*gousb.Device); ok {
+		device.ControlTimeout = d
+	}
+}
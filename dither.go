@@ -0,0 +1,158 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * dither.go
+ */
+
+package blinkstickgo
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// The refresh rate temporal dithering runs at unless told otherwise.
+const defaultDitherRate = 100
+
+// Keeps the frames being dithered and the loop redrawing them.
+type ditherer struct {
+	mu     sync.Mutex
+	rate   int
+	stop   chan struct{}
+	frames map[byte][]Color
+	errors map[byte][][3]float64 // The rounding error carried over for each LED.
+
+	// The stick each frame was written with, for its brightness, gamma, inversion, and
+	// so on, which copies made since dithering was turned on may have changed.
+	writers map[byte]BlinkStick
+}
+
+// EnableTemporalDither turns temporal dithering on or off.
+//
+// At low brightness, brightness and gamma correction leave colors between two whole
+// values, and rounding them makes fades step visibly or cut out entirely. With dithering
+// on, a background loop keeps redrawing the last frame written to each channel, flicking
+// each LED between the two nearest values so that on average it shows the exact color.
+//
+// Only whole frames are dithered (SetAllRGB, Flush, and friends), not single LEDs set
+// with SetRGB. It costs a full frame transfer at the refresh rate, for as long as it's
+// on, which is a fair bit of USB traffic and a little CPU. Close turns it off.
+func (stk *BlinkStick) EnableTemporalDither(enable bool) {
+	d := &stk.shared().dither
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !enable {
+		if d.stop != nil {
+			close(d.stop)
+			d.stop = nil
+		}
+		return
+	}
+	if d.stop != nil {
+		return
+	}
+
+	if d.rate <= 0 {
+		d.rate = defaultDitherRate
+	}
+	d.frames = map[byte][]Color{}
+	d.errors = map[byte][][3]float64{}
+	d.writers = map[byte]BlinkStick{}
+	d.stop = make(chan struct{})
+	redraw := *stk
+	redraw.background = true
+	go redraw.ditherLoop(d.stop, time.Second/time.Duration(d.rate))
+}
+
+// SetTemporalDitherRate sets how many times a second temporal dithering redraws each
+// channel. The default is 100. Higher rates flicker less, but cost more transfers.
+// It takes effect the next time dithering is turned on.
+func (stk *BlinkStick) SetTemporalDitherRate(hz int) {
+	d := &stk.shared().dither
+
+	d.mu.Lock()
+	d.rate = hz
+	d.mu.Unlock()
+}
+
+// Keeps a copy of a frame to dither, if dithering is on, along with the settings of the
+// stick that wrote it.
+func (d *ditherer) remember(stk *BlinkStick, channel byte, pixels []Color) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop == nil {
+		return
+	}
+
+	writer := *stk
+	writer.background = true
+	d.writers[channel] = writer
+	d.frames[channel] = append(d.frames[channel][:0], pixels...)
+	if len(d.errors[channel]) != len(pixels) {
+		d.errors[channel] = make([][3]float64, len(pixels))
+	}
+}
+
+// Stops dithering a channel, for when something else has been written to it.
+func (d *ditherer) forget(channel byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.frames, channel)
+	delete(d.writers, channel)
+}
+
+// Redraws every remembered frame at the given interval until stopped, each with the
+// settings it was written with.
+func (stk *BlinkStick) ditherLoop(stop chan struct{}, interval time.Duration) {
+	d := &stk.shared().dither
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		reports := map[byte][]byte{}
+		writers := map[byte]BlinkStick{}
+		for channel, pixels := range d.frames {
+			writer := d.writers[channel]
+			reports[channel] = writer.ditherFrame(channel, pixels, d.errors[channel])
+			writers[channel] = writer
+		}
+		d.mu.Unlock()
+
+		for channel, data := range reports {
+			writer := writers[channel]
+			writer.writeLEDData(channel, data)
+		}
+	}
+}
+
+// Packs a frame the way PackFrame does, except each LED is rounded up or down depending
+// on the error carried over from last time.
+func (stk *BlinkStick) ditherFrame(channel byte, pixels []Color, carried [][3]float64) []byte {
+	data := make([]byte, 0, len(pixels)*3)
+	for i, c := range pixels {
+		exact := stk.correctExact(c)
+
+		var out [3]byte
+		for j := range exact {
+			v := exact[j] + carried[i][j]
+			out[j] = byte(math.Max(0, math.Min(255, math.Floor(v))))
+			carried[i][j] = v - float64(out[j])
+		}
+
+		data = stk.appendWire(data, channel, out[0], out[1], out[2])
+	}
+	return data
+}
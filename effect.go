@@ -0,0 +1,441 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * effect.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An Effect is an animation that can be run by name with RunNamed, so effects can be
+// picked and tuned from a config file. Unlike an Animator, which colors one LED, an
+// Effect draws the whole of the default channel however it likes.
+type Effect interface {
+	// Update draws the effect as it should look t into running it. It's called once a
+	// frame, and an error stops the effect.
+	Update(ctx context.Context, stk *BlinkStick, t time.Duration) error
+}
+
+// An EffectFactory makes an Effect from its parameters, or returns an error if they're no
+// good. The parameters may be nil.
+type EffectFactory func(params map[string]any) (Effect, error)
+
+// The effects that can be run by name.
+var effects struct {
+	mu        sync.Mutex
+	factories map[string]EffectFactory
+}
+
+// RegisterEffect makes an effect available to RunNamed under a name, replacing any effect
+// already registered under it, built in or not.
+//
+// The built in effects run the package's own animations:
+//
+//	solid         a "color"
+//	pulse         Pulse, with a "color" and a "period"
+//	blink         Blink, with a "color" and an "interval"
+//	flicker       Flicker, with a "color" and an "intensity"
+//	rainbow       PaletteCycle around the hue wheel, with a "period" and a starting "hue"
+//	palettecycle  PaletteCycle, with a "palette" spread along the strip and a "speed"
+//	noise         NoiseField, with a "palette", a "scale", and a "speed"
+//	scroll        Scroll, with a "direction" and an "interval"
+//	chase         a lit LED with a fading tail going round, with a "color" and an "interval"
+//	twinkle       LEDs lighting up at random and fading, in a "color" or random hues
+//
+// Every parameter is optional. Colors can be given as a Color or by name, palettes as a
+// list of colors, durations as a time.Duration, a string for time.ParseDuration, or a
+// number of seconds, and other numbers as a float64 or an int.
+func RegisterEffect(name string, factory EffectFactory) {
+	effects.mu.Lock()
+	defer effects.mu.Unlock()
+	if effects.factories == nil {
+		effects.factories = map[string]EffectFactory{}
+	}
+	effects.factories[name] = factory
+}
+
+// Effects returns the names of every registered effect, sorted.
+func Effects() []string {
+	effects.mu.Lock()
+	defer effects.mu.Unlock()
+	names := make([]string, 0, len(effects.factories))
+	for name := range effects.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunNamed runs the effect registered under name on the default channel, made with the
+// given parameters, until ctx is done.
+func (stk *BlinkStick) RunNamed(ctx context.Context, name string, params map[string]any) error {
+	effects.mu.Lock()
+	factory, ok := effects.factories[name]
+	effects.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown effect %q", name)
+	}
+
+	effect, err := factory(params)
+	if err != nil {
+		return fmt.Errorf("effect %q: %w", name, err)
+	}
+	if anim, ok := effect.(animationEffect); ok {
+		return anim(ctx, stk)
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		err := effect.Update(ctx, stk, time.Since(start))
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// EffectFunc lets an ordinary function be used as an Effect.
+type EffectFunc func(ctx context.Context, stk *BlinkStick, t time.Duration) error
+
+// Update calls f(ctx, stk, t).
+func (f EffectFunc) Update(ctx context.Context, stk *BlinkStick, t time.Duration) error {
+	return f(ctx, stk, t)
+}
+
+// An animationEffect wraps one of the package's animations, which run their own frame
+// loops, so RunNamed hands it the whole run rather than calling Update every frame.
+type animationEffect func(ctx context.Context, stk *BlinkStick) error
+
+// Update runs the animation from the start for a frame's worth of time. RunNamed doesn't
+// use it, running the whole animation instead.
+func (f animationEffect) Update(ctx context.Context, stk *BlinkStick, t time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, frameInterval)
+	defer cancel()
+	if err := f(ctx, stk); err != ctx.Err() {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	RegisterEffect("solid", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		c, err := p.color("color", Color{255, 255, 255})
+		if err == nil {
+			err = p.only("color")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return EffectFunc(func(ctx context.Context, stk *BlinkStick, t time.Duration) error {
+			return stk.SetAllDefault(c.R, c.G, c.B)
+		}), nil
+	})
+
+	RegisterEffect("pulse", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		c, err := p.color("color", Color{255, 255, 255})
+		if err != nil {
+			return nil, err
+		}
+		period, err := p.duration("period", time.Second)
+		if err == nil {
+			err = p.only("color", "period")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			return stk.Pulse(ctx, stk.channel, c, period)
+		}), nil
+	})
+
+	RegisterEffect("blink", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		c, err := p.color("color", Color{255, 255, 255})
+		if err != nil {
+			return nil, err
+		}
+		interval, err := p.duration("interval", 500*time.Millisecond)
+		if err == nil {
+			err = p.only("color", "interval")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			return stk.Blink(ctx, stk.channel, c, interval)
+		}), nil
+	})
+
+	RegisterEffect("flicker", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		c, err := p.color("color", Color{255, 147, 41})
+		if err != nil {
+			return nil, err
+		}
+		intensity, err := p.number("intensity", 0.5)
+		if err == nil {
+			err = p.only("color", "intensity")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			return stk.Flicker(ctx, stk.channel, c, intensity)
+		}), nil
+	})
+
+	RegisterEffect("rainbow", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		period, err := p.duration("period", 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		hue, err := p.number("hue", 0)
+		if err == nil {
+			err = p.only("period", "hue")
+		}
+		if err != nil {
+			return nil, err
+		}
+		palette := hueWheel(hue)
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			indices := spreadPalette(stk.effectLEDs(), len(palette))
+			return stk.PaletteCycle(ctx, stk.channel, palette, indices, period/time.Duration(len(palette)))
+		}), nil
+	})
+
+	RegisterEffect("palettecycle", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		palette, err := p.palette("palette", hueWheel(0))
+		if err != nil {
+			return nil, err
+		}
+		speed, err := p.duration("speed", frameInterval)
+		if err == nil {
+			err = p.only("palette", "speed")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			indices := spreadPalette(stk.effectLEDs(), len(palette))
+			return stk.PaletteCycle(ctx, stk.channel, palette, indices, speed)
+		}), nil
+	})
+
+	RegisterEffect("noise", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		palette, err := p.palette("palette", []Color{{255, 0, 0}, {255, 128, 0}, {128, 0, 255}})
+		if err != nil {
+			return nil, err
+		}
+		scale, err := p.number("scale", 0.2)
+		if err != nil {
+			return nil, err
+		}
+		speed, err := p.number("speed", 0.5)
+		if err == nil {
+			err = p.only("palette", "scale", "speed")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			return stk.NoiseField(ctx, stk.channel, palette, scale, speed)
+		}), nil
+	})
+
+	RegisterEffect("scroll", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		direction, err := p.number("direction", 1)
+		if err != nil {
+			return nil, err
+		}
+		interval, err := p.duration("interval", 100*time.Millisecond)
+		if err == nil {
+			err = p.only("direction", "interval")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			return stk.Scroll(ctx, stk.channel, int(direction), interval)
+		}), nil
+	})
+
+	RegisterEffect("chase", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		c, err := p.color("color", Color{255, 255, 255})
+		if err != nil {
+			return nil, err
+		}
+		interval, err := p.duration("interval", 3*frameInterval)
+		if err == nil {
+			err = p.only("color", "interval")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			return stk.chase(ctx, stk.channel, stk.effectLEDs(), c, interval)
+		}), nil
+	})
+
+	RegisterEffect("twinkle", func(params map[string]any) (Effect, error) {
+		p := effectParams(params)
+		c, err := p.color("color", Color{})
+		if err == nil {
+			err = p.only("color")
+		}
+		if err != nil {
+			return nil, err
+		}
+		random := p["color"] == nil
+		return animationEffect(func(ctx context.Context, stk *BlinkStick) error {
+			pick := func() Color { return c }
+			if random {
+				pick = func() Color { return FromHSV(360*stk.randFloat64(), 1, 1) }
+			}
+			return stk.twinkle(ctx, stk.channel, stk.effectLEDs(), pick)
+		}), nil
+	})
+}
+
+// Returns how many LEDs an effect has to draw on, taking the Pro, which can't say, to have
+// just the one.
+func (stk *BlinkStick) effectLEDs() int {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+	return count
+}
+
+// Effect parameters, with helpers for reading them.
+type effectParams map[string]any
+
+// Returns an error if there are any parameters besides the ones named.
+func (p effectParams) only(names ...string) error {
+	for key := range p {
+		known := false
+		for _, name := range names {
+			known = known || key == name
+		}
+		if !known {
+			return fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	return nil
+}
+
+// Reads a color, given as a Color or by name.
+func (p effectParams) color(name string, def Color) (Color, error) {
+	switch v := p[name].(type) {
+	case nil:
+		return def, nil
+	case Color:
+		return v, nil
+	case string:
+		c, ok := ColorByName(v)
+		if !ok {
+			return Color{}, fmt.Errorf("parameter %q: unknown color %q", name, v)
+		}
+		return c, nil
+	default:
+		return Color{}, fmt.Errorf("parameter %q is a %T, not a color", name, v)
+	}
+}
+
+// Reads a number, given as a float64 or an int.
+func (p effectParams) number(name string, def float64) (float64, error) {
+	switch v := p[name].(type) {
+	case nil:
+		return def, nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("parameter %q is a %T, not a number", name, v)
+	}
+}
+
+// Reads a palette, given as a list of colors, each a Color or a name.
+func (p effectParams) palette(name string, def []Color) ([]Color, error) {
+	var colors []any
+	switch v := p[name].(type) {
+	case nil:
+		return def, nil
+	case []Color:
+		return v, nil
+	case []string:
+		for _, c := range v {
+			colors = append(colors, c)
+		}
+	case []any:
+		colors = v
+	default:
+		return nil, fmt.Errorf("parameter %q is a %T, not a palette", name, v)
+	}
+
+	palette := make([]Color, len(colors))
+	for i, v := range colors {
+		c, err := effectParams{name: v}.color(name, Color{})
+		if err != nil {
+			return nil, err
+		}
+		palette[i] = c
+	}
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("parameter %q is an empty palette", name)
+	}
+	return palette, nil
+}
+
+// Reads a positive duration, given as a time.Duration, a string for time.ParseDuration,
+// or a number of seconds.
+func (p effectParams) duration(name string, def time.Duration) (time.Duration, error) {
+	var d time.Duration
+	switch v := p[name].(type) {
+	case nil:
+		return def, nil
+	case time.Duration:
+		d = v
+	case string:
+		var err error
+		d, err = time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %q: %w", name, err)
+		}
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	case int:
+		d = time.Duration(v) * time.Second
+	default:
+		return 0, fmt.Errorf("parameter %q is a %T, not a duration", name, v)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("parameter %q must be positive, got %v", name, d)
+	}
+	return d, nil
+}
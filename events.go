@@ -0,0 +1,35 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * events.go
+ */
+
+package blinkstickgo
+
+import "fmt"
+
+// An EventMap maps event names to the actions that show them on a BlinkStick.
+//
+// The same map can be shared between several sticks so they all react to events alike.
+type EventMap map[string]func(*BlinkStick) error
+
+// RegisterEvent sets the action to run whenever the named event fires.
+func (stk *BlinkStick) RegisterEvent(name string, action func(*BlinkStick) error) {
+	if stk.Events == nil {
+		stk.Events = EventMap{}
+	}
+	stk.Events[name] = action
+}
+
+// OnEvent fires an event, running whatever action was registered for it.
+func (stk *BlinkStick) OnEvent(name string) error {
+	action, ok := stk.Events[name]
+	if !ok {
+		return fmt.Errorf("no action registered for event %q", name)
+	}
+	return action(stk)
+}
@@ -0,0 +1,99 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * flash.go
+ */
+
+package blinkstickgo
+
+import (
+	"sync"
+	"time"
+)
+
+// The LEDs FlashFor has flashed and not yet put back.
+type flashTable struct {
+	mu      sync.Mutex
+	flashes map[flashLED]*flash
+}
+
+// Which LED a flash is on.
+type flashLED struct {
+	channel, index byte
+}
+
+// The color an LED showed before it was flashed, and which flash it's waiting on.
+type flash struct {
+	original Color
+	latest   int
+}
+
+// FlashFor sets one LED to a color for d, then puts back whatever it was showing before.
+// It returns as soon as the color is set, and the LED is put back in the background.
+//
+// If the LED is flashed again before it's been put back, the new flash takes over, and
+// the LED is put back to what it showed before the first one once the last has ended.
+// Errors putting it back go to OnControlError, since there's no one to return them to.
+//
+// The color to put back comes from LastFrame, or is read from the device if there isn't
+// one, so anything else written to the LED during the flash is lost.
+func (stk *BlinkStick) FlashFor(channel, index byte, c Color, d time.Duration) error {
+	table := &stk.shared().flashes
+	led := flashLED{channel, index}
+
+	// The table isn't held while talking to the device, since a failed transfer calls
+	// the OnControlError hook, which may well flash an LED itself.
+	table.mu.Lock()
+	f, ok := table.flashes[led]
+	var original Color
+	if ok {
+		original = f.original
+	}
+	table.mu.Unlock()
+
+	if !ok {
+		frame, err := stk.currentFrame(channel)
+		if err != nil {
+			return err
+		}
+		if int(index) < len(frame.Pixels) {
+			original = frame.Pixels[index]
+		}
+	}
+
+	err := stk.SetRGB(channel, index, c.R, c.G, c.B)
+	if err != nil {
+		return err
+	}
+
+	table.mu.Lock()
+	f, ok = table.flashes[led]
+	if !ok {
+		if table.flashes == nil {
+			table.flashes = map[flashLED]*flash{}
+		}
+		f = &flash{original: original}
+		table.flashes[led] = f
+	}
+	f.latest++
+	latest := f.latest
+	table.mu.Unlock()
+
+	time.AfterFunc(d, func() {
+		table.mu.Lock()
+		if table.flashes[led] != f || f.latest != latest {
+			table.mu.Unlock()
+			return // Another flash has taken over.
+		}
+		delete(table.flashes, led)
+		original := f.original
+		table.mu.Unlock()
+
+		stk.SetRGB(channel, index, original.R, original.G, original.B)
+	})
+	return nil
+}
@@ -0,0 +1,67 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * font.go
+ */
+
+package blinkstickgo
+
+import "unicode"
+
+// The size of the characters DrawChar draws.
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// A tiny 3x5 font, enough for numbers and shouting. Each glyph is five rows from the
+// top, with the leftmost LED in bit 2 of each.
+var font3x5 = map[rune][glyphHeight]byte{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 3, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7},
+
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+
+	' ': {0, 0, 0, 0, 0}, '.': {0, 0, 0, 0, 2}, ',': {0, 0, 0, 2, 4}, '!': {2, 2, 2, 0, 2},
+	'?': {6, 1, 2, 0, 2}, '-': {0, 0, 7, 0, 0}, '+': {0, 2, 7, 2, 0}, '=': {0, 7, 0, 7, 0},
+	':': {0, 2, 0, 2, 0}, '/': {1, 1, 2, 4, 4}, '%': {5, 1, 2, 4, 5}, '\'': {2, 2, 0, 0, 0},
+	'(': {1, 2, 2, 2, 1}, ')': {4, 2, 2, 2, 4},
+}
+
+// DrawChar draws one character in fg on a background of bg, filling a width by height
+// matrix mapped through the layout, and writes it in one frame.
+//
+// The font is 3 LEDs wide and 5 tall, and the character is centered on the matrix, with
+// any part that doesn't fit cut off. It has digits, capital letters, and some punctuation.
+// Lowercase letters are drawn as capitals, and anything else the font doesn't have as a
+// question mark.
+func (stk *BlinkStick) DrawChar(channel byte, ch rune, fg, bg Color, width, height int) error {
+	glyph, ok := font3x5[unicode.ToUpper(ch)]
+	if !ok {
+		glyph = font3x5['?']
+	}
+
+	left := (width - glyphWidth) / 2
+	top := (height - glyphHeight) / 2
+	return stk.Fill2D(channel, width, height, func(x, y int) Color {
+		gx, gy := x-left, y-top
+		if gx < 0 || gx >= glyphWidth || gy < 0 || gy >= glyphHeight {
+			return bg
+		}
+		if glyph[gy]>>(glyphWidth-1-gx)&1 == 1 {
+			return fg
+		}
+		return bg
+	})
+}
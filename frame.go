@@ -0,0 +1,593 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * frame.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// A Frame holds a color for every LED on a channel, to be written all at once with Flush.
+type Frame struct {
+	Pixels []Color
+}
+
+// NewFrame returns a black frame for length LEDs.
+func NewFrame(length int) *Frame {
+	return &Frame{Pixels: make([]Color, length)}
+}
+
+// Fill sets every LED in the frame to one color.
+func (f *Frame) Fill(c Color) {
+	f.FillRange(0, len(f.Pixels), c)
+}
+
+// FillRange sets the LEDs from start up to, but not including, end. Indices outside the
+// frame are ignored.
+func (f *Frame) FillRange(start, end int, c Color) {
+	start, end = f.clip(start, end)
+	for i := start; i < end; i++ {
+		f.Pixels[i] = c
+	}
+}
+
+// FillGradient fades the LEDs from start up to, but not including, end from c1 to c2.
+// Indices outside the frame are ignored.
+func (f *Frame) FillGradient(start, end int, c1, c2 Color) {
+	span := end - start - 1
+	clippedStart, clippedEnd := f.clip(start, end)
+	for i := clippedStart; i < clippedEnd; i++ {
+		t := 0.0
+		if span > 0 {
+			t = float64(i-start) / float64(span)
+		}
+		f.Pixels[i] = MixColors(c1, c2, t)
+	}
+}
+
+// Rotate shifts every LED n places toward the end of the frame, wrapping the ones that
+// fall off back around to the start. A negative n shifts the other way.
+func (f *Frame) Rotate(n int) {
+	length := len(f.Pixels)
+	if length == 0 {
+		return
+	}
+	n %= length
+	if n < 0 {
+		n += length
+	}
+	rotated := append(append([]Color(nil), f.Pixels[length-n:]...), f.Pixels[:length-n]...)
+	copy(f.Pixels, rotated)
+}
+
+// Clamps a range of indices to the frame.
+func (f *Frame) clip(start, end int) (int, int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(f.Pixels) {
+		end = len(f.Pixels)
+	}
+	return start, end
+}
+
+// Keeps a copy of the last frame written to each channel, so it can be looked at without
+// asking the device.
+type frameMirror struct {
+	mu     sync.Mutex
+	frames map[byte][]Color
+}
+
+// LastFrame returns a copy of the last frame written to a channel, as the colors asked for
+// before any correction. It's false if nothing has been written to the channel yet, or
+// if a single LED has since been set past the end of the last frame.
+func (stk *BlinkStick) LastFrame(channel byte) (*Frame, bool) {
+	m := &stk.shared().mirror
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pixels, ok := m.frames[channel]
+	if !ok {
+		return nil, false
+	}
+	return &Frame{Pixels: append([]Color(nil), pixels...)}, true
+}
+
+// IsOn reports whether any LED on a channel is lit. It goes by LastFrame when it can, and
+// only reads from the device when it must.
+func (stk *BlinkStick) IsOn(channel byte) (bool, error) {
+	frame, err := stk.currentFrame(channel)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range frame.Pixels {
+		if c != (Color{}) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LitIndices returns the indexes of every LED on a channel that isn't black, in order,
+// for tracking down stray pixels an effect left behind. Like IsOn, it goes by LastFrame
+// when it can.
+func (stk *BlinkStick) LitIndices(channel byte) ([]int, error) {
+	frame, err := stk.currentFrame(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	var lit []int
+	for i, c := range frame.Pixels {
+		if c != (Color{}) {
+			lit = append(lit, i)
+		}
+	}
+	return lit, nil
+}
+
+// AverageColor returns the average of the colors a channel is showing, for carrying its
+// look over to other lights. Like IsOn, it goes by LastFrame when it can.
+func (stk *BlinkStick) AverageColor(channel byte) (Color, error) {
+	frame, err := stk.currentFrame(channel)
+	if err != nil {
+		return Color{}, err
+	}
+
+	switch len(frame.Pixels) {
+	case 0:
+		return Color{}, nil
+	case 1:
+		return frame.Pixels[0], nil
+	}
+
+	var sum [3]int
+	for _, c := range frame.Pixels {
+		sum[0] += int(c.R)
+		sum[1] += int(c.G)
+		sum[2] += int(c.B)
+	}
+	n := float64(len(frame.Pixels))
+	return Color{
+		R: byte(math.Round(float64(sum[0]) / n)),
+		G: byte(math.Round(float64(sum[1]) / n)),
+		B: byte(math.Round(float64(sum[2]) / n)),
+	}, nil
+}
+
+// Remembers a whole frame written to a channel.
+func (m *frameMirror) store(channel byte, pixels []Color) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.frames == nil {
+		m.frames = map[byte][]Color{}
+	}
+	m.frames[channel] = append(m.frames[channel][:0], pixels...) // LastFrame only hands out copies.
+}
+
+// Forgets the frame written to a channel, for when it's been overwritten with something
+// that can't be remembered.
+func (m *frameMirror) forget(channel byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.frames, channel)
+}
+
+// Updates one LED of a remembered frame. Setting an LED past its end leaves the rest of
+// the strip unknown, so the frame is forgotten.
+func (m *frameMirror) patch(channel byte, index int, c Color) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pixels, ok := m.frames[channel]
+	if !ok {
+		return
+	}
+	if index >= len(pixels) {
+		delete(m.frames, channel)
+		return
+	}
+	pixels[index] = c
+}
+
+// Flush writes a whole frame to a channel in one transfer.
+func (stk *BlinkStick) Flush(channel byte, f *Frame) error {
+	return stk.writeFrame(channel, f.Pixels)
+}
+
+// FlushSync writes a whole frame to a channel and only returns once the device has it,
+// for timing frames exactly, like syncing to audio.
+//
+// Control transfers are synchronous, so today this is no different from Flush. The
+// difference is that FlushSync promises to stay that way: if writes are ever buffered
+// or sent in the background, this will still wait for its frame to land.
+func (stk *BlinkStick) FlushSync(channel byte, f *Frame) error {
+	return stk.writeFrame(channel, f.Pixels)
+}
+
+// Fill sets every LED on a channel to the color fn gives for its index, and writes it
+// in one frame.
+func (stk *BlinkStick) Fill(channel byte, fn func(i int) Color) error {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+
+	pixels := make([]Color, count)
+	for i := range pixels {
+		pixels[i] = fn(i)
+	}
+	return stk.writeFrame(channel, pixels)
+}
+
+// A GradientStop is a color at a point along a MultiGradient, from 0 at the first LED to
+// 1 at the last.
+type GradientStop struct {
+	Position float64
+	Color    Color
+}
+
+// MultiGradient fades a channel through a list of colors, like a sunset, and writes it in
+// one frame. The stops must be in order and between 0 and 1. LEDs before the first stop
+// or after the last take that stop's color.
+func (stk *BlinkStick) MultiGradient(channel byte, stops []GradientStop) error {
+	if len(stops) == 0 {
+		return fmt.Errorf("no gradient stops")
+	}
+	for i, stop := range stops {
+		if stop.Position < 0 || stop.Position > 1 {
+			return fmt.Errorf("gradient stop %d is at %v, outside 0 to 1", i, stop.Position)
+		}
+		if i > 0 && stop.Position < stops[i-1].Position {
+			return fmt.Errorf("gradient stop %d at %v comes before the one ahead of it", i, stop.Position)
+		}
+	}
+
+	count := stk.GetLEDCount()
+	return stk.Fill(channel, func(i int) Color {
+		t := 0.0
+		if count > 1 {
+			t = float64(i) / float64(count-1)
+		}
+		if t <= stops[0].Position {
+			return stops[0].Color
+		}
+		for j := 1; j < len(stops); j++ {
+			a, b := stops[j-1], stops[j]
+			if t <= b.Position {
+				span := b.Position - a.Position
+				if span == 0 {
+					return b.Color
+				}
+				return a.Color.Lerp(b.Color, (t-a.Position)/span)
+			}
+		}
+		return stops[len(stops)-1].Color
+	})
+}
+
+// Tile repeats a palette along a channel, wrapping around as often as it takes to
+// fill every LED, and writes it in one frame.
+func (stk *BlinkStick) Tile(channel byte, palette []Color) error {
+	if len(palette) == 0 {
+		return fmt.Errorf("empty palette")
+	}
+
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = len(palette)
+	}
+
+	pixels := make([]Color, count)
+	for i := range pixels {
+		pixels[i] = palette[i%len(palette)]
+	}
+	return stk.writeFrame(channel, pixels)
+}
+
+// Scroll rotates whatever a channel is showing by one LED every interval, like a marquee,
+// until ctx is done. A direction of 1 moves it toward the end of the strip, and -1 back
+// toward the start.
+//
+// The frame comes from LastFrame, or is read from the device if there isn't one.
+func (stk *BlinkStick) Scroll(ctx context.Context, channel byte, direction int, interval time.Duration) error {
+	if direction != 1 && direction != -1 {
+		return fmt.Errorf("scroll direction must be 1 or -1, got %d", direction)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("scroll interval must be positive, got %v", interval)
+	}
+
+	frame, err := stk.currentFrame(channel)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		frame.Rotate(direction)
+		err := stk.Flush(channel, frame)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Decay moves every LED on a channel a fraction of the way toward a color, from 0 (not at
+// all) to 1 (all the way), and writes the result back. Called in a loop while something
+// else lights up LEDs, it leaves fading trails behind them, like a meteor.
+//
+// Each LED moves at least one step each call, so the strip does get all the way there
+// rather than stalling where rounding would leave it.
+func (stk *BlinkStick) Decay(channel byte, toward Color, factor float64) error {
+	factor = math.Max(0, math.Min(1, factor))
+	frame, err := stk.currentFrame(channel)
+	if err != nil {
+		return err
+	}
+
+	step := func(from, to, mixed byte) byte {
+		switch {
+		case factor == 0 || mixed != from:
+			return mixed
+		case from < to:
+			return from + 1
+		case from > to:
+			return from - 1
+		}
+		return from
+	}
+	for i, c := range frame.Pixels {
+		mixed := c.Lerp(toward, factor)
+		frame.Pixels[i] = Color{
+			R: step(c.R, toward.R, mixed.R),
+			G: step(c.G, toward.G, mixed.G),
+			B: step(c.B, toward.B, mixed.B),
+		}
+	}
+	return stk.Flush(channel, frame)
+}
+
+// Crossfade fades a channel from one frame to another over duration. The fade is worked
+// out in RGB unless InColorSpace says otherwise.
+//
+// If ctx is cancelled partway through, the LEDs are left where the fade got to and
+// ctx's error is returned.
+func (stk *BlinkStick) Crossfade(ctx context.Context, channel byte, from, to *Frame, duration time.Duration, opts ...AnimationOption) error {
+	space := gatherOptions(opts).space
+	return stk.crossfade(ctx, channel, from.Pixels, to.Pixels, int(duration/frameInterval), frameInterval, space)
+}
+
+// SetAllSoft fades every LED on a channel from whatever it's showing to c over ramp.
+//
+// Snapping a long strip straight to full white can make cheap USB power sag and flicker,
+// so this eases into it in a handful of steps instead. What's showing comes from
+// LastFrame, or is read from the device if there isn't one.
+func (stk *BlinkStick) SetAllSoft(channel byte, c Color, ramp time.Duration) error {
+	from, err := stk.currentFrame(channel)
+	if err != nil {
+		return err
+	}
+
+	to := NewFrame(len(from.Pixels))
+	to.Fill(c)
+
+	const steps = 8
+	return stk.crossfade(context.Background(), channel, from.Pixels, to.Pixels, steps, ramp/steps, ColorSpaceRGB)
+}
+
+// AutoDim waits for delay, then fades whatever a channel is showing at that point to
+// black over fade, like a bedside lamp's sleep timer.
+//
+// If ctx is done before the fade starts, nothing is dimmed. If it's done partway through,
+// the LEDs are left where the fade got to. Either way, ctx's error is returned.
+func (stk *BlinkStick) AutoDim(ctx context.Context, channel byte, delay, fade time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+	}
+
+	from, err := stk.currentFrame(channel)
+	if err != nil {
+		return err
+	}
+	to := NewFrame(len(from.Pixels))
+	return stk.Crossfade(ctx, channel, from, to, fade)
+}
+
+// Fades between two frames in the given number of steps, a set interval apart, working
+// out the fade in the given color space. LEDs missing from either frame count as black.
+func (stk *BlinkStick) crossfade(ctx context.Context, channel byte, from, to []Color, steps int, interval time.Duration, space ColorSpace) error {
+	length := len(from)
+	if len(to) > length {
+		length = len(to)
+	}
+	if steps < 1 {
+		steps = 1
+	}
+	if interval <= 0 {
+		interval = time.Nanosecond // Tickers need a positive interval, and this is as near to no wait as it gets.
+	}
+
+	pixels := make([]Color, length)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for step := 1; step <= steps; step++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		t := float64(step) / float64(steps)
+		for i := range pixels {
+			var a, b Color
+			if i < len(from) {
+				a = from[i]
+			}
+			if i < len(to) {
+				b = to[i]
+			}
+			pixels[i] = MixColorsIn(space, a, b, t)
+		}
+
+		err := stk.writeFrame(channel, pixels)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns what a channel is showing, going by LastFrame if it can and reading it from the
+// device if it must.
+func (stk *BlinkStick) currentFrame(channel byte) (*Frame, error) {
+	frame, ok := stk.LastFrame(channel)
+	if ok {
+		return frame, nil
+	}
+	pixels, err := stk.readFrame(channel)
+	if err != nil {
+		return nil, err
+	}
+	return &Frame{Pixels: pixels}, nil
+}
+
+// Reads back everything a channel is showing. The Pro can't say how many LEDs it has,
+// so all 64 are read.
+func (stk *BlinkStick) readFrame(channel byte) ([]Color, error) {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 64
+	}
+
+	data, err := stk.GetChannelLEDData(channel, count)
+	if err != nil {
+		return nil, err
+	}
+	return stk.unpackFrame(channel, data), nil
+}
+
+// PixelChange is one LED that differs between two frames, and its new color.
+type PixelChange struct {
+	Index int
+	Color Color
+}
+
+// DiffFrames compares two frames of RGB triplets, laid out like SetLEDData's, and returns
+// the LEDs that differ, for choosing between setting a few LEDs and rewriting the lot.
+//
+// If the frames are different lengths, the LEDs only one of them has count as changed.
+// Those past the end of new change to black, which is what writing new would leave them.
+func DiffFrames(old, new []byte) []PixelChange {
+	pixel := func(data []byte, i int) (Color, bool) {
+		if i*3 >= len(data) {
+			return Color{}, false
+		}
+		var rgb [3]byte
+		copy(rgb[:], data[i*3:])
+		return Color{rgb[0], rgb[1], rgb[2]}, true
+	}
+
+	length := (len(old) + 2) / 3
+	if n := (len(new) + 2) / 3; n > length {
+		length = n
+	}
+
+	var changes []PixelChange
+	for i := 0; i < length; i++ {
+		was, inOld := pixel(old, i)
+		now, inNew := pixel(new, i)
+		if inOld != inNew || was != now {
+			changes = append(changes, PixelChange{Index: i, Color: now})
+		}
+	}
+	return changes
+}
+
+// A FrameBuilder puts together a Frame one step at a time, for setting up scenes:
+//
+//	frame, err := NewFrameBuilder(32).
+//		Background(Color{0, 0, 32}).
+//		Gradient(8, 24, Color{255, 0, 0}, Color{255, 255, 0}).
+//		Pixel(0, Color{255, 255, 255}).
+//		Build()
+//
+// Steps are applied in order, so later ones paint over earlier ones.
+type FrameBuilder struct {
+	frame *Frame
+	err   error
+}
+
+// NewFrameBuilder starts building a black frame for length LEDs.
+func NewFrameBuilder(length int) *FrameBuilder {
+	return &FrameBuilder{frame: NewFrame(length)}
+}
+
+// Background sets every LED to c.
+func (fb *FrameBuilder) Background(c Color) *FrameBuilder {
+	fb.frame.Fill(c)
+	return fb
+}
+
+// Range sets the LEDs from start up to, but not including, end to c.
+func (fb *FrameBuilder) Range(start, end int, c Color) *FrameBuilder {
+	if fb.check(start, end) {
+		fb.frame.FillRange(start, end, c)
+	}
+	return fb
+}
+
+// Pixel sets a single LED to c.
+func (fb *FrameBuilder) Pixel(i int, c Color) *FrameBuilder {
+	if fb.check(i, i+1) {
+		fb.frame.Pixels[i] = c
+	}
+	return fb
+}
+
+// Gradient fades the LEDs from start up to, but not including, end from c1 to c2.
+func (fb *FrameBuilder) Gradient(start, end int, c1, c2 Color) *FrameBuilder {
+	if fb.check(start, end) {
+		fb.frame.FillGradient(start, end, c1, c2)
+	}
+	return fb
+}
+
+// Build returns the finished frame, or the first step that didn't fit in it.
+func (fb *FrameBuilder) Build() (*Frame, error) {
+	if fb.err != nil {
+		return nil, fb.err
+	}
+	return fb.frame, nil
+}
+
+// Records an error for Build if a range doesn't sit inside the frame.
+func (fb *FrameBuilder) check(start, end int) bool {
+	if start < 0 || end > len(fb.frame.Pixels) || start > end {
+		if fb.err == nil {
+			fb.err = fmt.Errorf("range %d-%d doesn't fit in a frame of %d LEDs", start, end, len(fb.frame.Pixels))
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,333 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * frame_test.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/different55/blinkstickgo/testdevice"
+)
+
+func TestFrameBuilder(t *testing.T) {
+	red, blue, white := Color{255, 0, 0}, Color{0, 0, 255}, Color{255, 255, 255}
+
+	frame, err := NewFrameBuilder(8).
+		Background(blue).
+		Gradient(2, 5, red, white).
+		Pixel(7, white).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Color{blue, blue, red, {255, 128, 128}, white, blue, blue, white}
+	for i := range want {
+		if frame.Pixels[i] != want[i] {
+			t.Errorf("pixel %d = %v, want %v", i, frame.Pixels[i], want[i])
+		}
+	}
+
+	_, err = NewFrameBuilder(8).Range(4, 9, red).Build()
+	if err == nil {
+		t.Error("Build allowed a range past the end of the frame")
+	}
+}
+
+func TestFrameRotate(t *testing.T) {
+	a, b, c := Color{1, 0, 0}, Color{2, 0, 0}, Color{3, 0, 0}
+
+	frame := &Frame{Pixels: []Color{a, b, c}}
+	frame.Rotate(1)
+	if want := []Color{c, a, b}; frame.Pixels[0] != want[0] || frame.Pixels[1] != want[1] || frame.Pixels[2] != want[2] {
+		t.Errorf("Rotate(1) = %v, want %v", frame.Pixels, want)
+	}
+	frame.Rotate(-4)
+	if want := []Color{a, b, c}; frame.Pixels[0] != want[0] || frame.Pixels[1] != want[1] || frame.Pixels[2] != want[2] {
+		t.Errorf("Rotate(-4) = %v, want %v", frame.Pixels, want)
+	}
+}
+
+func TestDiffFrames(t *testing.T) {
+	frame := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	if changes := DiffFrames(frame, frame); len(changes) != 0 {
+		t.Errorf("DiffFrames of identical frames = %v, want nothing", changes)
+	}
+
+	changes := DiffFrames(frame, []byte{9, 8, 7, 6, 5, 4, 3, 2, 1})
+	want := []PixelChange{{0, Color{9, 8, 7}}, {1, Color{6, 5, 4}}, {2, Color{3, 2, 1}}}
+	if len(changes) != len(want) {
+		t.Fatalf("DiffFrames of different frames = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("DiffFrames of different frames = %v, want %v", changes, want)
+			break
+		}
+	}
+
+	changes = DiffFrames(frame, []byte{1, 2, 3, 4, 5, 0})
+	want = []PixelChange{{1, Color{4, 5, 0}}, {2, Color{}}}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("DiffFrames of a sparse, shorter frame = %v, want %v", changes, want)
+	}
+
+	changes = DiffFrames(nil, []byte{0, 0, 0})
+	if len(changes) != 1 || changes[0] != (PixelChange{0, Color{}}) {
+		t.Errorf("DiffFrames of a longer frame = %v, want LED 0 changed to black", changes)
+	}
+}
+
+func TestMultiGradient(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 5
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	red, green, blue := Color{255, 0, 0}, Color{0, 255, 0}, Color{0, 0, 255}
+	err := stk.MultiGradient(0, []GradientStop{{0, red}, {0.5, green}, {1, blue}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := stk.LastFrame(0)
+	want := []Color{red, {128, 128, 0}, green, {0, 128, 128}, blue}
+	for i := range want {
+		if frame.Pixels[i] != want[i] {
+			t.Errorf("MultiGradient = %v, want %v", frame.Pixels, want)
+			break
+		}
+	}
+
+	if err := stk.MultiGradient(0, []GradientStop{{0.5, red}, {0.2, blue}}); err == nil {
+		t.Error("MultiGradient allowed unsorted stops")
+	}
+	if err := stk.MultiGradient(0, []GradientStop{{0, red}, {1.5, blue}}); err == nil {
+		t.Error("MultiGradient allowed a stop past 1")
+	}
+}
+
+func TestDecay(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 2
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if err := stk.Flush(0, &Frame{Pixels: []Color{{200, 100, 1}, {0, 0, 0}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stk.Decay(0, Color{}, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := stk.LastFrame(0)
+	if want := (Color{150, 75, 0}); frame.Pixels[0] != want || frame.Pixels[1] != (Color{}) {
+		t.Errorf("Decay = %v, want %v and black", frame.Pixels, want)
+	}
+
+	for i := 0; i < 100; i++ {
+		stk.Decay(0, Color{}, 0.1)
+	}
+	if frame, _ := stk.LastFrame(0); frame.Pixels[0] != (Color{}) {
+		t.Errorf("Decay stalled at %v", frame.Pixels[0])
+	}
+}
+
+func TestComposite(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 3
+	stk := NewBlinkStick(device, "BS000001-3.0")
+
+	alert := stk.NewLayer(10)
+	background := stk.NewLayer(0)
+	background.Fill(Color{0, 0, 200}, 1)
+	alert.Set(1, Color{200, 0, 0}, 0.5)
+	alert.Set(2, Color{200, 0, 0}, 0)
+
+	if err := stk.Composite(0); err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := stk.LastFrame(0)
+	want := []Color{{0, 0, 200}, {100, 0, 100}, {0, 0, 200}}
+	for i := range want {
+		if frame.Pixels[i] != want[i] {
+			t.Errorf("Composite = %v, want %v", frame.Pixels, want)
+			break
+		}
+	}
+
+	alert.Remove()
+	stk.Composite(0)
+	if frame, _ := stk.LastFrame(0); frame.Pixels[1] != (Color{0, 0, 200}) {
+		t.Errorf("Composite after Remove = %v, want the background", frame.Pixels)
+	}
+}
+
+func TestAutoDim(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 2
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if err := stk.Flush(0, &Frame{Pixels: []Color{{200, 100, 50}, {10, 20, 30}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	device.Reset()
+	if err := stk.AutoDim(ctx, 0, 10*time.Millisecond, 0); err != context.Canceled {
+		t.Errorf("AutoDim with ctx cancelled = %v, want %v", err, context.Canceled)
+	}
+	if writes := device.Writes(); len(writes) != 0 {
+		t.Errorf("AutoDim dimmed after ctx was cancelled, writes = %v", writes)
+	}
+
+	if err := stk.AutoDim(context.Background(), 0, time.Millisecond, 5*frameInterval); err != nil {
+		t.Fatal(err)
+	}
+	if frame, _ := stk.LastFrame(0); frame.Pixels[0] != (Color{}) || frame.Pixels[1] != (Color{}) {
+		t.Errorf("AutoDim left %v, want black", frame.Pixels)
+	}
+	if writes := device.Writes(); len(writes) != 5 {
+		t.Errorf("AutoDim made %d writes over five frames", len(writes))
+	}
+}
+
+func TestAverageColor(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 3
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if err := stk.Flush(0, &Frame{Pixels: []Color{{255, 0, 10}, {0, 255, 10}, {0, 0, 11}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	device.Reset()
+	if c, err := stk.AverageColor(0); err != nil || c != (Color{85, 85, 10}) {
+		t.Errorf("AverageColor = %v, %v, want {85 85 10}", c, err)
+	}
+	if len(device.Transfers()) != 0 {
+		t.Error("AverageColor read from the device when LastFrame had the frame")
+	}
+}
+
+func TestScenes(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 2
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	day := []Color{{255, 255, 255}, {255, 200, 100}}
+	if err := stk.Flush(0, &Frame{Pixels: day}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.SaveScene("day"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stk.Off(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stk.RecallScene("day"); err != nil {
+		t.Fatal(err)
+	}
+	if frame, _ := stk.LastFrame(0); frame.Pixels[0] != day[0] || frame.Pixels[1] != day[1] {
+		t.Errorf("RecallScene showed %v, want %v", frame.Pixels, day)
+	}
+
+	stk.Off(0)
+	if err := stk.CrossfadeScene(context.Background(), "day", 2*frameInterval); err != nil {
+		t.Fatal(err)
+	}
+	if frame, _ := stk.LastFrame(0); frame.Pixels[1] != day[1] {
+		t.Errorf("CrossfadeScene ended on %v, want %v", frame.Pixels, day)
+	}
+
+	if err := stk.RecallScene("night"); err == nil {
+		t.Error("RecallScene found a scene that was never saved")
+	}
+}
+
+func TestLitIndices(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	if err := stk.Tile(0, []Color{{}, {}, {1, 0, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	lit, err := stk.LitIndices(0)
+	if err != nil || len(lit) != 2 || lit[0] != 2 || lit[1] != 5 {
+		t.Errorf("LitIndices = %v, %v, want [2 5]", lit, err)
+	}
+
+	stk.Off(0)
+	if lit, _ := stk.LitIndices(0); len(lit) != 0 {
+		t.Errorf("LitIndices with everything off = %v, want none", lit)
+	}
+}
+
+func TestRestoreLastFrame(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetBrightness(0.5)
+	if err := stk.SetAllRGB(0, 200, 100, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := stk.Snapshot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stk.SetAllRGB(0, 0, 0, 255)
+	if err := stk.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, ok := stk.LastFrame(0)
+	if !ok || len(frame.Pixels) != 8 || frame.Pixels[7] != (Color{200, 100, 0}) {
+		t.Errorf("LastFrame after Restore = %v, %v, want the uncorrected colors", frame, ok)
+	}
+}
+
+func TestOverlayCorrectsOnce(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetBrightness(0.5)
+	if err := stk.SetAllRGB(0, 100, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	first := device.Writes()[0].Data
+
+	for i := 0; i < 2; i++ {
+		if err := stk.Overlay(0, []Color{{255, 0, 0}}, []float64{0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writes := device.Writes()
+	if last := writes[len(writes)-1].Data; string(last) != string(first) {
+		t.Errorf("Overlay with no opacity wrote %v, want it unchanged from %v", last, first)
+	}
+}
+
+func TestSetAllSoftFromLastFrame(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.SetBrightness(0.5)
+	if err := stk.SetAllRGB(0, 100, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	want := device.Writes()[0].Data
+	device.Reset()
+
+	// Fading to what's already showing shouldn't dip along the way.
+	if err := stk.SetAllSoft(0, Color{100, 100, 100}, 8*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range device.Writes() {
+		if w.IsWrite() && string(w.Data) != string(want) {
+			t.Errorf("SetAllSoft to the same color wrote %v, want %v", w.Data, want)
+		}
+	}
+}
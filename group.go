@@ -0,0 +1,53 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * group.go
+ */
+
+package blinkstickgo
+
+// A Group drives several BlinkSticks as one, each on its default channel.
+type Group struct {
+	Sticks []*BlinkStick
+}
+
+// NewGroup returns a group of the given sticks.
+func NewGroup(sticks ...*BlinkStick) *Group {
+	return &Group{Sticks: sticks}
+}
+
+// SetAll sets every LED on every stick to one color.
+func (g *Group) SetAll(c Color) error {
+	return g.each(func(stk *BlinkStick) error {
+		return stk.SetAllDefault(c.R, c.G, c.B)
+	})
+}
+
+// MirrorPattern shows the same pattern on every stick, resampled to each one's LED count
+// so that sticks of different lengths all show the whole thing.
+func (g *Group) MirrorPattern(p *Pattern) error {
+	return g.each(func(stk *BlinkStick) error {
+		count := stk.GetLEDCount()
+		if count < 0 {
+			count = len(p.Colors)
+		}
+		return stk.writeFrame(stk.channel, p.Resample(count))
+	})
+}
+
+// Calls fn for every stick, carrying on past failures so one unplugged stick doesn't stop
+// the rest. The first error is returned.
+func (g *Group) each(fn func(stk *BlinkStick) error) error {
+	var first error
+	for _, stk := range g.Sticks {
+		err := fn(stk)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
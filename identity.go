@@ -0,0 +1,144 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * identity.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gousb"
+)
+
+// Identity records which physical BlinkStick is which, so it can be found again later.
+//
+// It's a plain struct, meant to be saved with encoding/json or similar.
+type Identity struct {
+	Serial  string
+	Variant Variant
+	Name    string
+}
+
+// Identity returns the identity of the device.
+func (stk *BlinkStick) Identity() Identity {
+	return Identity{
+		Serial:  stk.Serial,
+		Variant: stk.GetVariant(),
+		Name:    stk.GetName(),
+	}
+}
+
+// FindByIdentity finds the connected BlinkStick with the same serial as id.
+//
+// Every other stick found along the way is closed. If the stick isn't plugged in,
+// ErrDeviceNotFound is returned.
+func FindByIdentity(id Identity) (*BlinkStick, error) {
+	sticks, err := FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	found := pick(sticks, func(stk *BlinkStick) bool { return stk.Serial == id.Serial })
+	if found == nil {
+		return nil, ErrDeviceNotFound
+	}
+	return found, nil
+}
+
+// FindByNameContains finds every connected BlinkStick whose name, as set with SetName,
+// contains substr, ignoring case. Sticks named "desk" and "desk lamp" both match "desk".
+//
+// The rest are closed. If nothing matches, ErrDeviceNotFound is returned.
+func FindByNameContains(substr string) ([]BlinkStick, error) {
+	sticks, err := FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	substr = strings.ToLower(substr)
+	var found []BlinkStick
+	for _, stk := range sticks {
+		if strings.Contains(strings.ToLower(stk.GetName()), substr) {
+			found = append(found, stk)
+		} else {
+			stk.Device.Close()
+		}
+	}
+	if len(found) == 0 {
+		return nil, ErrDeviceNotFound
+	}
+	return found, nil
+}
+
+// A SerialProblem is what's wrong with a serial that FindAllWithSerialWarnings warns about.
+type SerialProblem int
+
+// The problems a serial can have.
+const (
+	SerialBlank     SerialProblem = iota // The stick has no serial, or it couldn't be read.
+	SerialDuplicate                      // Another stick has the same serial.
+)
+
+func (p SerialProblem) String() string {
+	switch p {
+	case SerialBlank:
+		return "blank"
+	case SerialDuplicate:
+		return "duplicate"
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// A SerialWarning points out a stick whose serial can't be used to find it, along with
+// where it's plugged in so it can be tracked down. Bus and Address are zero if they
+// aren't known.
+type SerialWarning struct {
+	Serial  string
+	Problem SerialProblem
+	Bus     int
+	Address int
+}
+
+// FindAllWithSerialWarnings is FindAll, but also warns about every stick with a blank
+// serial or one that another stick shares, as unprogrammed sticks often do. Anything that
+// finds sticks by serial, like FindByIdentity or OpenResilient, can't tell those apart.
+func FindAllWithSerialWarnings() ([]BlinkStick, []SerialWarning, error) {
+	sticks, err := FindAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sticks, serialWarnings(sticks), nil
+}
+
+// Returns a warning for every stick with a blank or duplicated serial.
+func serialWarnings(sticks []BlinkStick) []SerialWarning {
+	counts := map[string]int{}
+	for _, stk := range sticks {
+		counts[stk.Serial]++
+	}
+
+	var warnings []SerialWarning
+	for _, stk := range sticks {
+		w := SerialWarning{Serial: stk.Serial}
+		switch {
+		case stk.Serial == "":
+			w.Problem = SerialBlank
+		case counts[stk.Serial] > 1:
+			w.Problem = SerialDuplicate
+		default:
+			continue
+		}
+		if device, ok := stk.Device.(*gousb.Device); ok && device.Desc != nil {
+			w.Bus, w.Address = device.Desc.Bus, device.Desc.Address
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings
+}
@@ -0,0 +1,200 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * image.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Layout describes how the LEDs of a matrix are wired together, so grids of colors can
+// be mapped onto the strip.
+type Layout int
+
+// The supported wiring layouts. Both start from the top left corner.
+const (
+	LayoutRows       Layout = iota // Row by row, every row running left to right.
+	LayoutSerpentine               // Row by row, snaking back and forth so every other row runs right to left.
+)
+
+// SetLayout sets how the LEDs of a matrix are wired, for DrawImage and Fill2D. The
+// default is LayoutRows.
+func (stk *BlinkStick) SetLayout(layout Layout) {
+	stk.layout = layout
+}
+
+// Returns which LED sits at (x, y) in a grid width LEDs wide.
+func (stk *BlinkStick) gridIndex(x, y, width int) int {
+	if stk.layout == LayoutSerpentine && y%2 == 1 {
+		return y*width + (width - 1 - x)
+	}
+	return y*width + x
+}
+
+// Checks that a width by height grid fits on the device.
+func (stk *BlinkStick) checkGrid(width, height int) error {
+	if width < 1 || height < 1 {
+		return fmt.Errorf("invalid grid size %dx%d", width, height)
+	}
+	if count := stk.GetLEDCount(); count >= 0 && width*height > count {
+		return fmt.Errorf("%dx%d grid needs %d LEDs, but the device only has %d", width, height, width*height, count)
+	}
+	return nil
+}
+
+// Fill2D sets every LED of a width by height matrix to the color fn gives for its
+// position, mapped through the layout, and writes it in one frame.
+func (stk *BlinkStick) Fill2D(channel byte, width, height int, fn func(x, y int) Color) error {
+	err := stk.checkGrid(width, height)
+	if err != nil {
+		return err
+	}
+
+	pixels := make([]Color, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels[stk.gridIndex(x, y, width)] = fn(x, y)
+		}
+	}
+	return stk.writeFrame(channel, pixels)
+}
+
+// DrawImage scales an image down to a width by height grid of LEDs and shows it.
+//
+// Each LED shows the average of the pixels it covers. With dither set, the rounding
+// error from each LED is spread onto its neighbours (Floyd-Steinberg), which keeps
+// smooth gradients from turning into bands. The grid is mapped onto the strip according
+// to SetLayout.
+func (stk *BlinkStick) DrawImage(channel byte, img image.Image, width, height int, dither bool) error {
+	err := stk.checkGrid(width, height)
+	if err != nil {
+		return err
+	}
+
+	grid := sampleImage(img, width, height)
+	if dither {
+		ditherGrid(grid, width, height)
+	}
+
+	pixels := make([]Color, len(grid))
+	for i, cell := range grid {
+		pixels[stk.gridIndex(i%width, i/width, width)] = quantize(cell)
+	}
+	return stk.writeFrame(channel, pixels)
+}
+
+// Snapshot2D reads back what the default channel is showing and lays it out as a width
+// by height image according to SetLayout, for showing the lights on a dashboard. Passing
+// 0 for both gives a strip image instead, one LED per pixel in a single row.
+//
+// The colors are the ones the LEDs show, so any inversion is undone, but brightness and
+// gamma aren't. LEDs the grid doesn't cover are left out, and cells past the end of the
+// strip come out black.
+func (stk *BlinkStick) Snapshot2D(width, height int) (image.Image, error) {
+	if width != 0 || height != 0 {
+		err := stk.checkGrid(width, height)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pixels, err := stk.readFrame(stk.channel)
+	if err != nil {
+		return nil, err
+	}
+	if width == 0 && height == 0 {
+		width, height = len(pixels), 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := Color{}
+			if i := stk.gridIndex(x, y, width); i < len(pixels) {
+				c = pixels[i]
+			}
+			img.Set(x, y, color.RGBA{c.R, c.G, c.B, 255})
+		}
+	}
+	return img, nil
+}
+
+// Averages the pixels under each cell of a width by height grid laid over img.
+func sampleImage(img image.Image, width, height int) [][3]float64 {
+	bounds := img.Bounds()
+	grid := make([][3]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [3]float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum[0] += float64(r) / 257
+					sum[1] += float64(g) / 257
+					sum[2] += float64(b) / 257
+				}
+			}
+
+			n := float64((x1 - x0) * (y1 - y0))
+			grid[y*width+x] = [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+		}
+	}
+	return grid
+}
+
+// Rounds each cell to whole color values, pushing the error onto cells yet to be rounded.
+func ditherGrid(grid [][3]float64, width, height int) {
+	spread := func(x, y int, err [3]float64, weight float64) {
+		if x < 0 || x >= width || y >= height {
+			return
+		}
+		for i := range err {
+			grid[y*width+x][i] += err[i] * weight
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			cell := &grid[y*width+x]
+			c := quantize(*cell)
+			err := [3]float64{cell[0] - float64(c.R), cell[1] - float64(c.G), cell[2] - float64(c.B)}
+			*cell = [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+
+			spread(x+1, y, err, 7.0/16)
+			spread(x-1, y+1, err, 3.0/16)
+			spread(x, y+1, err, 5.0/16)
+			spread(x+1, y+1, err, 1.0/16)
+		}
+	}
+}
+
+// Rounds and clamps a cell to a Color.
+func quantize(cell [3]float64) Color {
+	clamp := func(v float64) byte {
+		return byte(math.Max(0, math.Min(255, math.Round(v))))
+	}
+	return Color{R: clamp(cell[0]), G: clamp(cell[1]), B: clamp(cell[2])}
+}
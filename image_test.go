@@ -0,0 +1,127 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * image_test.go
+ */
+
+package blinkstickgo
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/different55/blinkstickgo/testdevice"
+)
+
+func TestDitherGrid(t *testing.T) {
+	// A flat field halfway between two values should come out as a mix of both, not all one.
+	grid := make([][3]float64, 8)
+	for i := range grid {
+		grid[i] = [3]float64{10.5, 10.5, 10.5}
+	}
+	ditherGrid(grid, 8, 1)
+
+	var sum float64
+	for _, cell := range grid {
+		if cell[0] != 10 && cell[0] != 11 {
+			t.Fatalf("dithered value %v is not one of the neighbouring levels", cell[0])
+		}
+		sum += cell[0]
+	}
+	if sum != 84 {
+		t.Errorf("dithered sum = %v, want 84", sum)
+	}
+}
+
+func TestSampleImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.RGBA{255, 0, 0, 255})
+		img.Set(x, 1, color.RGBA{0, 0, 255, 255})
+	}
+
+	grid := sampleImage(img, 2, 1)
+	for _, cell := range grid {
+		if quantize(cell) != (Color{128, 0, 128}) {
+			t.Errorf("sampled cell = %v, want the average of red and blue", quantize(cell))
+		}
+	}
+}
+
+func TestGridIndex(t *testing.T) {
+	var stk BlinkStick
+	if got := stk.gridIndex(1, 1, 3); got != 4 {
+		t.Errorf("rows gridIndex(1, 1) = %d, want 4", got)
+	}
+
+	stk.SetLayout(LayoutSerpentine)
+	if got := stk.gridIndex(0, 1, 3); got != 5 {
+		t.Errorf("serpentine gridIndex(0, 1) = %d, want 5", got)
+	}
+	if got := stk.gridIndex(0, 2, 3); got != 6 {
+		t.Errorf("serpentine gridIndex(0, 2) = %d, want 6", got)
+	}
+}
+
+func TestSnapshot2D(t *testing.T) {
+	stk := NewBlinkStick(testdevice.New(), "BS000001-3.0")
+	stk.Inverse = true
+	stk.SetLayout(LayoutSerpentine)
+
+	pixels := make([]Color, 8)
+	for i := range pixels {
+		pixels[i] = Color{byte(i), 0, 0}
+	}
+	if err := stk.writeFrame(0, pixels); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := stk.Snapshot2D(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(0, 1).RGBA(); r>>8 != 7 {
+		t.Errorf("serpentine snapshot (0, 1) has red %d, want LED 7's", r>>8)
+	}
+
+	img, err = stk.Snapshot2D(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 1 {
+		t.Errorf("strip snapshot is %dx%d, want 8x1", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := img.At(3, 0).RGBA(); r>>8 != 3 {
+		t.Errorf("strip snapshot (3, 0) has red %d, want 3", r>>8)
+	}
+}
+
+func TestDrawChar(t *testing.T) {
+	device := testdevice.New()
+	device.LEDs = 25
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	fg, bg := Color{255, 255, 255}, Color{0, 0, 9}
+
+	if err := stk.DrawChar(0, 't', fg, bg, 5, 5); err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := stk.LastFrame(0)
+	for i, want := range []Color{bg, fg, fg, fg, bg, bg, bg, fg, bg, bg} {
+		if frame.Pixels[i] != want {
+			t.Errorf("DrawChar('t') LED %d = %v, want %v", i, frame.Pixels[i], want)
+		}
+	}
+
+	if err := stk.DrawChar(0, '§', fg, bg, 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	frame, _ = stk.LastFrame(0)
+	if frame.Pixels[0] != fg || frame.Pixels[2] != bg || frame.Pixels[5] != fg {
+		t.Errorf("DrawChar of an unknown rune = %v, want a question mark", frame.Pixels[:15])
+	}
+}
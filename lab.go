@@ -0,0 +1,116 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * lab.go
+ */
+
+package blinkstickgo
+
+import "math"
+
+// A ColorSpace is a way of describing colors that fades can be worked out in.
+type ColorSpace int
+
+// The color spaces fades can be worked out in.
+const (
+	// ColorSpaceRGB fades each of red, green, and blue separately, which is quick, but
+	// can pass through muddy colors. Red to green goes by way of brown.
+	ColorSpaceRGB ColorSpace = iota
+
+	// ColorSpaceLab fades through CIE L*a*b*, which is laid out so that equal steps look
+	// about equally different, for smoother fades between different hues.
+	ColorSpaceLab
+)
+
+// InColorSpace makes Morph and Crossfade fade through the given color space rather than
+// straight through RGB.
+func InColorSpace(space ColorSpace) AnimationOption {
+	return func(o *animationOptions) {
+		o.space = space
+	}
+}
+
+// MixColorsIn is MixColors, working out the mix in the given color space.
+func MixColorsIn(space ColorSpace, a, b Color, t float64) Color {
+	if space != ColorSpaceLab {
+		return MixColors(a, b, t)
+	}
+
+	t = math.Max(0, math.Min(1, t))
+	l1, a1, b1 := a.ToLab()
+	l2, a2, b2 := b.ToLab()
+	return FromLab(l1+(l2-l1)*t, a1+(a2-a1)*t, b1+(b2-b1)*t)
+}
+
+// The D65 white point, which sRGB is defined against, in CIE XYZ.
+const whiteX, whiteY, whiteZ = 0.95047, 1.0, 1.08883
+
+// ToLab returns the color in CIE L*a*b*, taking it as sRGB under D65 light. L runs from 0
+// for black to 100 for white, and a and b are roughly between -128 and 127.
+func (c Color) ToLab() (l, a, b float64) {
+	r, g, bl := srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*bl) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*bl) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*bl) / whiteZ
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// FromLab returns the sRGB color for a color in CIE L*a*b*, as ToLab gives. Colors sRGB
+// can't show are clamped.
+func FromLab(l, a, b float64) Color {
+	fy := (l + 16) / 116
+	x := whiteX * labFInverse(fy+a/500)
+	y := whiteY * labFInverse(fy)
+	z := whiteZ * labFInverse(fy-b/200)
+
+	return Color{
+		R: linearToSRGB(3.2404542*x - 1.5371385*y - 0.4985314*z),
+		G: linearToSRGB(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+		B: linearToSRGB(0.0556434*x - 0.2040259*y + 1.0572252*z),
+	}
+}
+
+// The cube root L*a*b* is built on, with a straight line near zero so it doesn't get
+// infinitely steep.
+func labF(t float64) float64 {
+	const delta = 6.0 / 29
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29
+}
+
+// Undoes labF.
+func labFInverse(t float64) float64 {
+	const delta = 6.0 / 29
+	if t > delta {
+		return t * t * t
+	}
+	return 3 * delta * delta * (t - 4.0/29)
+}
+
+// Converts an sRGB channel to linear light, from 0 to 1.
+func srgbToLinear(v byte) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+// Converts linear light back to an sRGB channel, clamping it to what sRGB can show.
+func linearToSRGB(c float64) byte {
+	c = math.Max(0, math.Min(1, c))
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return byte(math.Round(c * 255))
+}
@@ -0,0 +1,122 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * layer.go
+ */
+
+package blinkstickgo
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// A Layer is one of a stack of translucent frames that Composite flattens onto a channel,
+// for keeping, say, a background, an effect, and an alert apart. Every LED in a layer has
+// its own opacity, from 0 (transparent) to 1 (opaque), and starts out transparent.
+type Layer struct {
+	z     int
+	table *layerTable
+
+	mu     sync.Mutex
+	pixels []Color
+	alpha  []float64
+}
+
+// The layers made with NewLayer, bottom first.
+type layerTable struct {
+	mu     sync.Mutex
+	layers []*Layer
+}
+
+// NewLayer adds a layer as long as the strip, stacked by z: higher layers cover lower
+// ones, and layers with the same z stack in the order they were made. Layers are shared
+// by every copy of the BlinkStick.
+func (stk *BlinkStick) NewLayer(z int) *Layer {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+
+	table := &stk.shared().layers
+	l := &Layer{
+		z:      z,
+		table:  table,
+		pixels: make([]Color, count),
+		alpha:  make([]float64, count),
+	}
+
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	table.layers = append(table.layers, l)
+	sort.SliceStable(table.layers, func(i, j int) bool { return table.layers[i].z < table.layers[j].z })
+	return l
+}
+
+// Composite flattens every layer onto black, bottom to top, and writes the result to a
+// channel in one frame.
+func (stk *BlinkStick) Composite(channel byte) error {
+	table := &stk.shared().layers
+	table.mu.Lock()
+	layers := append([]*Layer(nil), table.layers...)
+	table.mu.Unlock()
+
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+	frame := NewFrame(count)
+	for _, l := range layers {
+		l.mu.Lock()
+		for i := 0; i < len(frame.Pixels) && i < len(l.pixels); i++ {
+			frame.Pixels[i] = BlendOver(frame.Pixels[i], l.pixels[i], l.alpha[i])
+		}
+		l.mu.Unlock()
+	}
+	return stk.Flush(channel, frame)
+}
+
+// Set sets one LED in the layer, with an opacity from 0 to 1. LEDs past the end of the
+// layer are ignored.
+func (l *Layer) Set(index int, c Color, alpha float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index < 0 || index >= len(l.pixels) {
+		return
+	}
+	l.pixels[index] = c
+	l.alpha[index] = math.Max(0, math.Min(1, alpha))
+}
+
+// Fill sets every LED in the layer to one color and opacity.
+func (l *Layer) Fill(c Color, alpha float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	alpha = math.Max(0, math.Min(1, alpha))
+	for i := range l.pixels {
+		l.pixels[i] = c
+		l.alpha[i] = alpha
+	}
+}
+
+// Clear makes the whole layer transparent.
+func (l *Layer) Clear() {
+	l.Fill(Color{}, 0)
+}
+
+// Remove takes the layer out of the stack for good.
+func (l *Layer) Remove() {
+	l.table.mu.Lock()
+	defer l.table.mu.Unlock()
+	for i, other := range l.table.layers {
+		if other == l {
+			l.table.layers = append(l.table.layers[:i], l.table.layers[i+1:]...)
+			return
+		}
+	}
+}
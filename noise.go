@@ -0,0 +1,81 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * noise.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// NoiseField fills a channel with slowly drifting blobs of color from a palette, like a
+// lava lamp, until ctx is done.
+//
+// Each LED shows the palette at the point given by 1D value noise sampled at
+// position*scale + time*speed, with time in seconds, blending between neighbouring
+// palette colors. Smaller scales make bigger blobs, and higher speeds make them drift
+// faster.
+//
+// The noise is simple value noise: every whole number gets a pseudorandom value from
+// hashing it, and the values in between are eased from one to the next with a
+// smoothstep. It's not as even as Perlin or simplex noise, but on a strip of LEDs it's
+// hard to tell, and it's cheap.
+func (stk *BlinkStick) NoiseField(ctx context.Context, channel byte, palette []Color, scale, speed float64) error {
+	if len(palette) == 0 {
+		return fmt.Errorf("empty palette")
+	}
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 1
+	}
+
+	pixels := make([]Color, count)
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		t := float64(frame) * frameInterval.Seconds() * speed
+		for i := range pixels {
+			pixels[i] = paletteAt(palette, valueNoise(float64(i)*scale+t))
+		}
+
+		err := stk.writeFrame(channel, pixels)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns smooth 1D value noise at x, from 0 up to 1.
+func valueNoise(x float64) float64 {
+	floor := math.Floor(x)
+	frac := x - floor
+	frac = frac * frac * (3 - 2*frac)
+
+	a := latticeValue(int64(floor))
+	b := latticeValue(int64(floor) + 1)
+	return a + (b-a)*frac
+}
+
+// Hashes a whole number to a pseudorandom value from 0 up to 1, the same every time.
+func latticeValue(n int64) float64 {
+	h := uint64(n) * 0x9E3779B97F4A7C15
+	h ^= h >> 31
+	h *= 0xBF58476D1CE4E5B9
+	h ^= h >> 29
+	return float64(h>>11) / (1 << 53)
+}
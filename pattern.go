@@ -0,0 +1,70 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * pattern.go
+ */
+
+package blinkstickgo
+
+import "math"
+
+// A Pattern is a row of colors that isn't tied to any one length of strip. It's stretched
+// or squeezed to fit whatever it's shown on.
+type Pattern struct {
+	Colors []Color
+}
+
+// NewPattern returns a pattern of the given colors.
+func NewPattern(colors ...Color) *Pattern {
+	return &Pattern{Colors: colors}
+}
+
+// Resample fits the pattern to length LEDs.
+//
+// Stretching it interpolates between neighbouring colors, and squeezing it averages the
+// colors that land on each LED, so a fine pattern blurs rather than losing pixels.
+func (p *Pattern) Resample(length int) []Color {
+	pixels := make([]Color, length)
+	n := len(p.Colors)
+	switch {
+	case length == 0 || n == 0:
+	case n == 1:
+		for i := range pixels {
+			pixels[i] = p.Colors[0]
+		}
+	case length >= n:
+		for i := range pixels {
+			pos := 0.0
+			if length > 1 {
+				pos = float64(i) * float64(n-1) / float64(length-1)
+			}
+			lo := int(pos)
+			if lo >= n-1 {
+				pixels[i] = p.Colors[n-1]
+				continue
+			}
+			pixels[i] = MixColors(p.Colors[lo], p.Colors[lo+1], pos-float64(lo))
+		}
+	default:
+		for i := range pixels {
+			start, end := i*n/length, (i+1)*n/length
+			var sum [3]float64
+			for _, c := range p.Colors[start:end] {
+				sum[0] += float64(c.R)
+				sum[1] += float64(c.G)
+				sum[2] += float64(c.B)
+			}
+			count := float64(end - start)
+			pixels[i] = Color{
+				R: byte(math.Round(sum[0] / count)),
+				G: byte(math.Round(sum[1] / count)),
+				B: byte(math.Round(sum[2] / count)),
+			}
+		}
+	}
+	return pixels
+}
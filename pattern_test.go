@@ -0,0 +1,33 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * pattern_test.go
+ */
+
+package blinkstickgo
+
+import "testing"
+
+func TestPatternResample(t *testing.T) {
+	black, white := Color{}, Color{255, 255, 255}
+	p := NewPattern(black, white)
+
+	got := p.Resample(5)
+	want := []Color{black, {64, 64, 64}, {128, 128, 128}, {191, 191, 191}, white}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Resample(5) = %v, want %v", got, want)
+			break
+		}
+	}
+
+	p = NewPattern(black, white, white, black)
+	got = p.Resample(2)
+	if half := (Color{128, 128, 128}); got[0] != half || got[1] != half {
+		t.Errorf("Resample(2) = %v, want both %v", got, half)
+	}
+}
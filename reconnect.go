@@ -0,0 +1,96 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * reconnect.go
+ */
+
+package blinkstickgo
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gousb"
+)
+
+// How many times OpenResilient's sticks try to reconnect before giving up.
+const defaultReconnects = 3
+
+// How long to wait between attempts to reconnect, to give a replugged stick time to come
+// back.
+const reconnectDelay = 500 * time.Millisecond
+
+// OpenResilient finds the BlinkStick with the given serial and sets it up to survive being
+// unplugged and plugged back in, or the host suspending, with SetReconnectAttempts(3).
+// Every other stick found along the way is closed.
+func OpenResilient(serial string) (*BlinkStick, error) {
+	sticks, err := FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	found := pick(sticks, func(stk *BlinkStick) bool { return stk.Serial == serial })
+	if found == nil {
+		return nil, ErrDeviceNotFound
+	}
+	found.SetReconnectAttempts(defaultReconnects)
+	return found, nil
+}
+
+// SetReconnectAttempts sets how many times to try finding the stick again by its serial
+// when a transfer fails because it's gone, half a second apart. Once it's back, the
+// failed transfer is retried, so callers never see the error. A count of 0, the default,
+// turns reconnecting off.
+//
+// Each reconnection counts as a retry in Stats. The transfer holds the device's mutex the
+// whole time, so everything else using the stick waits until it's back or given up on.
+func (stk *BlinkStick) SetReconnectAttempts(n int) {
+	state := stk.shared()
+	state.mu.Lock()
+	state.reconnects = n
+	state.mu.Unlock()
+}
+
+// Tries to reopen the device by serial, with the mutex held, reporting whether it did.
+func (stk *BlinkStick) reconnect(state *deviceState) bool {
+	if stk.Serial == "" {
+		return false
+	}
+
+	for attempt := 0; attempt < state.reconnects; attempt++ {
+		if attempt > 0 {
+			time.Sleep(reconnectDelay)
+		}
+
+		device, err := openSerial(stk.Serial)
+		if err == ErrNotInitialized {
+			return false
+		}
+		if err != nil || device == nil {
+			continue
+		}
+		stk.Device.Close()
+		state.device, stk.Device = device, device
+		atomic.AddUint64(&state.stats.retries, 1)
+		return true
+	}
+	return false
+}
+
+// Switches the stick over to the device it's been reconnected to, if any. The mutex must
+// be held.
+func (stk *BlinkStick) syncDevice(state *deviceState) {
+	if state.device != nil {
+		stk.Device = state.device
+	}
+}
+
+// Reports whether a transfer failed because the device has gone away.
+func isDisconnect(err error) bool {
+	return errors.Is(err, gousb.ErrorNoDevice) || errors.Is(err, gousb.ErrorIO)
+}
@@ -0,0 +1,131 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * report.go
+ */
+
+package blinkstickgo
+
+import (
+	"sort"
+	"sync"
+)
+
+// A feature report for setting LED data, and how many LEDs it has room for.
+type ledReport struct {
+	id      uint16
+	maxLEDs uint16
+}
+
+// The LED data reports found in the device's HID report descriptor, once it's been read.
+type reportTable struct {
+	mu      sync.Mutex
+	parsed  bool
+	reports []ledReport
+}
+
+// Returns the LED data reports the device describes, reading and parsing its report
+// descriptor the first time. It's empty if that couldn't be done, in which case
+// getReportID falls back on the reports every current BlinkStick uses, and it's tried
+// again next time, since the failure may only have been a busy device.
+//
+// A noWait stick doesn't wait on another one reading the descriptor, and makes do with
+// the fallback.
+func (stk *BlinkStick) ledReports() []ledReport {
+	table := &stk.shared().reports
+	if !stk.noWait {
+		table.mu.Lock()
+	} else if !table.mu.TryLock() {
+		return nil
+	}
+	defer table.mu.Unlock()
+
+	if !table.parsed {
+		reports, err := stk.parseReportDescriptor()
+		if err != nil {
+			return nil
+		}
+		table.reports, table.parsed = reports, true
+	}
+	return table.reports
+}
+
+// Reads the device's HID report descriptor and picks out the LED data reports.
+func (stk *BlinkStick) parseReportDescriptor() ([]ledReport, error) {
+	buffer := make([]byte, 512)
+
+	// A standard GET_DESCRIPTOR request for the HID report descriptor of interface 0.
+	n, err := stk.transfer(0x81, 0x06, 0x2200, 0x00, buffer)
+	if err != nil {
+		return nil, err
+	}
+	return parseLEDReports(buffer[:n]), nil
+}
+
+// Walks a HID report descriptor for feature reports shaped like LED data: a channel
+// byte followed by whole RGB triplets. They're returned smallest first.
+func parseLEDReports(desc []byte) []ledReport {
+	type globals struct {
+		size, count, id uint32
+	}
+	var state globals
+	var stack []globals
+	lengths := map[uint32]uint32{} // Feature report lengths in bits, by report ID.
+
+	for i := 0; i < len(desc); {
+		prefix := desc[i]
+		if prefix == 0xFE { // A long item, which nothing we care about uses.
+			if i+1 >= len(desc) {
+				break
+			}
+			i += 3 + int(desc[i+1])
+			continue
+		}
+
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if i+1+size > len(desc) {
+			break
+		}
+
+		var value uint32
+		for j := 0; j < size; j++ {
+			value |= uint32(desc[i+1+j]) << (8 * j)
+		}
+
+		switch prefix & 0xFC {
+		case 0x74: // Report Size
+			state.size = value
+		case 0x84: // Report ID
+			state.id = value
+		case 0x94: // Report Count
+			state.count = value
+		case 0xA4: // Push
+			stack = append(stack, state)
+		case 0xB4: // Pop
+			if len(stack) > 0 {
+				state, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		case 0xB0: // Feature
+			lengths[state.id] += state.size * state.count
+		}
+		i += 1 + size
+	}
+
+	var reports []ledReport
+	for id, bits := range lengths {
+		payload := bits / 8
+		if id == 0 || payload < 4 || (payload-1)%3 != 0 {
+			continue
+		}
+		reports = append(reports, ledReport{id: uint16(id), maxLEDs: uint16((payload - 1) / 3)})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].maxLEDs < reports[j].maxLEDs })
+	return reports
+}
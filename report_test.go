@@ -0,0 +1,80 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * report_test.go
+ */
+
+package blinkstickgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/different55/blinkstickgo/testdevice"
+)
+
+func TestParseLEDReports(t *testing.T) {
+	desc := []byte{
+		0x06, 0x00, 0xFF, // Usage Page (Vendor Defined)
+		0x09, 0x01, // Usage
+		0xA1, 0x01, // Collection (Application)
+		0x75, 0x08, // Report Size (8)
+		0x85, 0x01, 0x95, 0x03, 0xB2, 0x02, 0x01, // Report 1: a single RGB color
+		0x85, 0x06, 0x95, 0x19, 0xB2, 0x02, 0x01, // Report 6: channel and 8 LEDs
+		0x85, 0x09, 0x96, 0xC1, 0x00, 0xB2, 0x02, 0x01, // Report 9: channel and 64 LEDs
+		0x85, 0x04, 0x95, 0x01, 0xB2, 0x02, 0x01, // Report 4: the mode
+		0xC0, // End Collection
+	}
+
+	reports := parseLEDReports(desc)
+	want := []ledReport{{id: 6, maxLEDs: 8}, {id: 9, maxLEDs: 64}}
+	if len(reports) != len(want) {
+		t.Fatalf("parseLEDReports found %v, want %v", reports, want)
+	}
+	for i := range want {
+		if reports[i] != want[i] {
+			t.Errorf("parseLEDReports found %v, want %v", reports, want)
+		}
+	}
+}
+
+func TestReportDescriptorRetried(t *testing.T) {
+	device := testdevice.New()
+	stk := NewBlinkStick(device, "BS000001-3.0")
+	stk.GetLEDCount()
+
+	// Keep the device busy so that the first try at the descriptor fails.
+	device.Block()
+	done := make(chan error)
+	go func() {
+		_, err := stk.GetMode()
+		done <- err
+	}()
+	for device.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if ok, err := stk.TrySetAll(0, Color{255, 0, 0}); ok || err != nil {
+		t.Errorf("TrySetAll on a busy device = %v, %v, want false, nil", ok, err)
+	}
+	device.Unblock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stk.SetAllRGB(0, 0, 0, 255); err != nil {
+		t.Fatal(err)
+	}
+	reads := 0
+	for _, tr := range device.Transfers() {
+		if tr.Request == 0x06 {
+			reads++
+		}
+	}
+	if reads != 1 {
+		t.Errorf("read the report descriptor %d times after a busy first try, want 1", reads)
+	}
+}
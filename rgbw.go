@@ -0,0 +1,97 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * rgbw.go
+ */
+
+package blinkstickgo
+
+import "fmt"
+
+// SetRGBW sets one LED on an RGBW strip, including its white channel. The RGBW field must
+// be set, and only the Flex can drive RGBW LEDs.
+//
+// The firmware knows nothing about RGBW, and just sends each pixel's bytes down the strip
+// in turn, so a few things don't work the way they do with RGB LEDs:
+//
+//   - The device counts LEDs as three bytes each, so its LED count needs to be set to
+//     four thirds of the number of RGBW pixels (and rounded up).
+//   - There's no report for setting one RGBW LED, so this reads the channel's LED data
+//     back and writes the whole thing.
+//   - White gets brightness and inversion, but not gamma or color correction.
+//   - SetReversed, LastFrame, temporal dithering, and everything built on Color only
+//     understand RGB, so they can't be used with RGBW data.
+func (stk *BlinkStick) SetRGBW(channel, index, r, g, b, w byte) error {
+	err := stk.checkRGBW()
+	if err != nil {
+		return err
+	}
+
+	count := stk.GetLEDCount()
+	if count < 0 {
+		return fmt.Errorf("couldn't get the LED count")
+	}
+	data, err := stk.GetChannelLEDData(channel, count)
+	if err != nil {
+		return err
+	}
+
+	offset := int(index) * 4
+	if offset+4 > len(data) {
+		return fmt.Errorf("RGBW LED %d is past the end of the strip's %d bytes", index, len(data))
+	}
+	copy(data[offset:], stk.appendRGBW(nil, channel, r, g, b, w))
+	return stk.writeRGBW(channel, data)
+}
+
+// Packs and writes a slice of alternating RGBW values, padded out to whole LEDs.
+func (stk *BlinkStick) setRGBWData(channel byte, data []byte) error {
+	err := stk.checkRGBW()
+	if err != nil {
+		return err
+	}
+
+	padded := make([]byte, (len(data)+3)/4*4)
+	copy(padded, data)
+
+	packed := make([]byte, 0, len(padded))
+	for i := 0; i < len(padded); i += 4 {
+		packed = stk.appendRGBW(packed, channel, padded[i], padded[i+1], padded[i+2], padded[i+3])
+	}
+	return stk.writeRGBW(channel, packed)
+}
+
+// Writes packed RGBW data, which the mirror and ditherer can't keep track of.
+func (stk *BlinkStick) writeRGBW(channel byte, data []byte) error {
+	state := stk.shared()
+	state.dither.forget(channel)
+	state.mirror.forget(channel)
+	return stk.writeLEDData(channel, data)
+}
+
+// Returns an error if RGBW data can't be written to the device.
+func (stk *BlinkStick) checkRGBW() error {
+	switch {
+	case !stk.RGBW:
+		return fmt.Errorf("the RGBW field isn't set")
+	case stk.GetVariant() != VariantFlex:
+		return ErrUnsupported
+	case stk.reversed || stk.ringOffset != 0:
+		return fmt.Errorf("RGBW LEDs can't be reversed or rotated")
+	}
+	return nil
+}
+
+// Appends one RGBW LED to data, corrected and in the device's byte order with white last.
+func (stk *BlinkStick) appendRGBW(data []byte, channel, r, g, b, w byte) []byte {
+	data = stk.appendColor(data, channel, r, g, b)
+	w = stk.applyBrightness(Color{w, w, w}).R
+	if stk.isInverse(channel) {
+		w = 255 - w
+	}
+	return append(data, w)
+}
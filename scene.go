@@ -0,0 +1,83 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * scene.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The scenes saved with SaveScene.
+type sceneTable struct {
+	mu     sync.Mutex
+	scenes map[string][]Color
+}
+
+// SaveScene remembers what the default channel is showing under a name, for switching
+// back to later with RecallScene. Saving under a name that's already taken replaces the
+// old scene. Scenes are kept in memory, shared by every copy of the BlinkStick, and are
+// gone once the program exits.
+//
+// The frame comes from LastFrame, or is read from the device if there isn't one.
+func (stk *BlinkStick) SaveScene(name string) error {
+	frame, err := stk.currentFrame(stk.channel)
+	if err != nil {
+		return err
+	}
+
+	table := &stk.shared().scenes
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if table.scenes == nil {
+		table.scenes = map[string][]Color{}
+	}
+	table.scenes[name] = frame.Pixels
+	return nil
+}
+
+// RecallScene shows a scene saved with SaveScene on the default channel.
+func (stk *BlinkStick) RecallScene(name string) error {
+	pixels, err := stk.scene(name)
+	if err != nil {
+		return err
+	}
+	return stk.writeFrame(stk.channel, pixels)
+}
+
+// CrossfadeScene is RecallScene, but fades from whatever's showing to the scene over
+// duration. If ctx is cancelled partway through, the LEDs are left where the fade got
+// to and ctx's error is returned.
+func (stk *BlinkStick) CrossfadeScene(ctx context.Context, name string, duration time.Duration) error {
+	pixels, err := stk.scene(name)
+	if err != nil {
+		return err
+	}
+
+	from, err := stk.currentFrame(stk.channel)
+	if err != nil {
+		return err
+	}
+	return stk.Crossfade(ctx, stk.channel, from, &Frame{Pixels: pixels}, duration)
+}
+
+// Returns the scene saved under name.
+func (stk *BlinkStick) scene(name string) ([]Color, error) {
+	table := &stk.shared().scenes
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	pixels, ok := table.scenes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scene %q", name)
+	}
+	return pixels, nil
+}
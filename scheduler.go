@@ -0,0 +1,102 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * scheduler.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An Animator decides what color a single LED should be at any given moment.
+type Animator interface {
+	Frame(t time.Time) Color
+}
+
+// AnimatorFunc lets an ordinary function be used as an Animator.
+type AnimatorFunc func(t time.Time) Color
+
+// Frame calls f(t).
+func (f AnimatorFunc) Frame(t time.Time) Color {
+	return f(t)
+}
+
+// The animators scheduled on a stick.
+type scheduler struct {
+	sync.Mutex
+	animators map[int]Animator
+}
+
+// Schedule sets the Animator driving one LED. A nil anim unschedules it.
+//
+// It's safe to call while Run is going.
+func (stk *BlinkStick) Schedule(index int, anim Animator) {
+	s := &stk.shared().sched
+
+	s.Lock()
+	defer s.Unlock()
+	if anim == nil {
+		delete(s.animators, index)
+	} else {
+		if s.animators == nil {
+			s.animators = map[int]Animator{}
+		}
+		s.animators[index] = anim
+	}
+}
+
+// Run draws every scheduled Animator onto a channel, one frame at a time, until ctx is done.
+//
+// Each tick, every animator is asked for its color and the whole frame goes out in a
+// single transfer, so any number of animations can share the device without fighting
+// over it. LEDs without an animator are left black.
+func (stk *BlinkStick) Run(ctx context.Context, channel byte) error {
+	s := &stk.shared().sched
+
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			err := stk.writeFrame(channel, s.frame(stk, now))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Composites every scheduled animator into a frame for time t.
+func (s *scheduler) frame(stk *BlinkStick, t time.Time) []Color {
+	s.Lock()
+	defer s.Unlock()
+
+	// A count that can't be read comes back as -1, leaving just the animators to size the frame.
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 0
+	}
+	for index := range s.animators {
+		if index >= count {
+			count = index + 1
+		}
+	}
+
+	pixels := make([]Color, count)
+	for index, anim := range s.animators {
+		if index >= 0 {
+			pixels[index] = anim.Frame(t)
+		}
+	}
+	return pixels
+}
@@ -0,0 +1,58 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * sink.go
+ */
+
+package blinkstickgo
+
+import "context"
+
+// Sink returns a channel that sets every LED on a channel to each Color sent down it.
+//
+// If colors arrive faster than the device can take them, the backlog is skipped and only
+// the newest is shown. It stops when ctx is done or the returned channel is closed. There's
+// nowhere to report failed writes, so keep an eye on Stats if that matters.
+func (stk *BlinkStick) Sink(ctx context.Context, channel byte) chan<- Color {
+	colors := make(chan Color, 16)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c, ok := <-colors:
+				if !ok {
+					return
+				}
+
+				c, open := latest(colors, c)
+				stk.SetAllRGB(channel, c.R, c.G, c.B)
+				if !open {
+					return
+				}
+			}
+		}
+	}()
+	return colors
+}
+
+// Drains anything already waiting in colors, returning the newest color and whether colors
+// is still open.
+func latest(colors <-chan Color, c Color) (Color, bool) {
+	for {
+		select {
+		case next, ok := <-colors:
+			if !ok {
+				return c, false
+			}
+			c = next
+		default:
+			return c, true
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * sleep.go
+ */
+
+package blinkstickgo
+
+import (
+	"sync"
+	"time"
+)
+
+// What Sleep stopped, so Wake can start it again.
+type sleepState struct {
+	mu       sync.Mutex
+	asleep   bool
+	watchdog time.Duration // The watchdog's timeout, or 0 if it wasn't on.
+	dither   bool
+}
+
+// The animations started with RunAsync that haven't finished yet.
+type animationTable struct {
+	mu      sync.Mutex
+	handles map[*AnimationHandle]struct{}
+}
+
+// Sleep parks the device: every animation started with RunAsync is cancelled and waited
+// for, the watchdog and temporal dithering are stopped, and every LED on every channel
+// is turned off, so nothing touches the device until it's woken up. Unlike Close, the
+// device stays open, so Wake is instant. Sleeping again while asleep does nothing.
+//
+// Sleep waits for animations to finish, so it mustn't be called from inside one.
+// Anything written to the device while it's asleep still goes through.
+func (stk *BlinkStick) Sleep() error {
+	state := stk.shared()
+	s := &state.sleep
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.asleep {
+		return nil
+	}
+	s.asleep = true
+
+	state.running.mu.Lock()
+	var handles []*AnimationHandle
+	for h := range state.running.handles {
+		handles = append(handles, h)
+	}
+	state.running.mu.Unlock()
+	for _, h := range handles {
+		h.Cancel()
+		<-h.Done()
+	}
+
+	state.watchdog.mu.Lock()
+	s.watchdog = 0
+	if state.watchdog.timer != nil {
+		s.watchdog = state.watchdog.timeout
+	}
+	state.watchdog.mu.Unlock()
+	stk.DisableWatchdog()
+
+	state.dither.mu.Lock()
+	s.dither = state.dither.stop != nil
+	state.dither.mu.Unlock()
+	stk.EnableTemporalDither(false)
+
+	// Forgetting the flashes stops FlashFor from putting them back.
+	state.flashes.mu.Lock()
+	state.flashes.flashes = nil
+	state.flashes.mu.Unlock()
+
+	return stk.OffAllChannels()
+}
+
+// Wake undoes Sleep, starting the watchdog and temporal dithering again if they were on.
+// The LEDs stay off, and cancelled animations stay cancelled, until they're set again.
+func (stk *BlinkStick) Wake() {
+	s := &stk.shared().sleep
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.asleep {
+		return
+	}
+	s.asleep = false
+
+	if s.watchdog > 0 {
+		stk.EnableWatchdog(s.watchdog)
+	}
+	if s.dither {
+		stk.EnableTemporalDither(true)
+	}
+}
@@ -0,0 +1,53 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * snapshot.go
+ */
+
+package blinkstickgo
+
+// A Snapshot holds what a channel was showing at some point, so it can be put back later.
+type Snapshot struct {
+	Channel byte
+	data    []byte  // Exactly as read from the device, so restoring doesn't correct it twice.
+	pixels  []Color // What LastFrame said beforehand, if anything, to go back in the mirror.
+}
+
+// Snapshot reads everything a channel is currently showing.
+func (stk *BlinkStick) Snapshot(channel byte) (Snapshot, error) {
+	count := stk.GetLEDCount()
+	if count < 0 {
+		count = 64
+	}
+
+	data, err := stk.GetChannelLEDData(channel, count)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{Channel: channel, data: data}
+	if frame, ok := stk.LastFrame(channel); ok {
+		snap.pixels = frame.Pixels
+	}
+	return snap, nil
+}
+
+// Restore puts a channel back the way it was when the snapshot was taken.
+//
+// LastFrame goes back to what it was too. If it had nothing when the snapshot was taken,
+// only the corrected colors were known, so it's left with nothing again.
+func (stk *BlinkStick) Restore(snap Snapshot) error {
+	err := stk.writeLEDData(snap.Channel, snap.data)
+	if err != nil {
+		return err
+	}
+	if snap.pixels != nil {
+		stk.shared().mirror.store(snap.Channel, snap.pixels)
+	} else {
+		stk.shared().mirror.forget(snap.Channel)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * stats.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts the control transfers made to a device, for monitoring.
+type Stats struct {
+	TransfersOK     uint64
+	TransfersFailed uint64
+	Retries         uint64
+	LastError       error // The most recent failure, or nil if there hasn't been one.
+}
+
+// The live counters behind Stats.
+type transferStats struct {
+	ok, failed, retries uint64
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// Stats returns a snapshot of the transfer counters. They're shared by every copy of
+// the BlinkStick, and are safe to read while other goroutines use the device.
+func (stk *BlinkStick) Stats() Stats {
+	ts := &stk.shared().stats
+
+	ts.mu.Lock()
+	lastErr := ts.lastErr
+	ts.mu.Unlock()
+
+	return Stats{
+		TransfersOK:     atomic.LoadUint64(&ts.ok),
+		TransfersFailed: atomic.LoadUint64(&ts.failed),
+		Retries:         atomic.LoadUint64(&ts.retries),
+		LastError:       lastErr,
+	}
+}
+
+// Counts one transfer's result.
+func (ts *transferStats) record(err error) {
+	if err == nil {
+		atomic.AddUint64(&ts.ok, 1)
+		return
+	}
+
+	atomic.AddUint64(&ts.failed, 1)
+	ts.mu.Lock()
+	ts.lastErr = err
+	ts.mu.Unlock()
+}
+
+// PingLatency measures how long a control transfer takes, for working out how many frames
+// a second the device can keep up with.
+//
+// It reads the LED count report samples times and returns the average round trip. The
+// first read is left out, since it's often slow while the USB stack warms up, so there
+// need to be at least two samples.
+func (stk *BlinkStick) PingLatency(samples int) (time.Duration, error) {
+	if samples < 2 {
+		return 0, fmt.Errorf("need at least two samples, got %d", samples)
+	}
+
+	buffer := make([]byte, 2)
+	var total time.Duration
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		err := stk.control(0x80|0x20, 0x01, 0x81, 0x00, buffer)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			total += time.Since(start)
+		}
+	}
+	return total / time.Duration(samples-1), nil
+}
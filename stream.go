@@ -0,0 +1,66 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * stream.go
+ */
+
+package blinkstickgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PlayStream plays pre-rendered frames from r, such as a light show saved to a file, at
+// fps frames a second until r runs out or ctx is done.
+//
+// Each frame is frameLen bytes of RGB triplets, written as if by SetLEDData. A short last
+// frame is padded out with black, unless the StrictFrames option is given, in which case
+// io.ErrUnexpectedEOF is returned. If ctx ends first, its error is returned.
+func (stk *BlinkStick) PlayStream(ctx context.Context, channel byte, r io.Reader, frameLen int, fps int, opts ...AnimationOption) error {
+	if frameLen <= 0 || fps <= 0 {
+		return fmt.Errorf("frame length and fps must be positive, got %d and %d", frameLen, fps)
+	}
+	interval := time.Second / time.Duration(fps)
+	if interval <= 0 {
+		return fmt.Errorf("fps must be at most %d, got %d", time.Second, fps)
+	}
+	o := gatherOptions(opts)
+
+	frame := make([]byte, frameLen)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := io.ReadFull(r, frame)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF && !o.strictFrame:
+			for i := n; i < len(frame); i++ {
+				frame[i] = 0
+			}
+		case err != nil:
+			return err
+		}
+
+		err = stk.SetLEDData(channel, frame)
+		if err != nil {
+			return err
+		}
+		if n < frameLen {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,223 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * testdevice/testdevice.go
+ */
+
+// Package testdevice provides a fake BlinkStick for testing code without any hardware.
+//
+// Wrap one with blinkstickgo.NewBlinkStick, drive it as usual, then look at what was
+// sent with Transfers or Writes:
+//
+//	device := testdevice.New()
+//	stk := blinkstickgo.NewBlinkStick(device, "BS000001-3.0")
+//	stk.SetRGB(0, 0, 255, 0, 0)
+//	t.Log(device.Writes())
+package testdevice
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrClosed is returned by every transfer once the device has been closed.
+var ErrClosed = errors.New("testdevice: device closed")
+
+// Transfer is one recorded control transfer.
+type Transfer struct {
+	RequestType uint8
+	Request     uint8
+	Value       uint16
+	Index       uint16
+	Data        []byte // The payload sent, or for reads, what was sent back.
+}
+
+// IsWrite reports whether the transfer sent data to the device.
+func (t Transfer) IsWrite() bool {
+	return t.RequestType&0x80 == 0
+}
+
+func (t Transfer) String() string {
+	return fmt.Sprintf("type %#02x request %#02x value %#04x index %d: %v", t.RequestType, t.Request, t.Value, t.Index, t.Data)
+}
+
+// Device is a fake BlinkStick that records every control transfer made to it.
+//
+// Feature reports written to it are remembered and sent back when read, like the real
+// thing, and the LED count report answers with LEDs until it's written. It's safe to
+// use from several goroutines.
+type Device struct {
+	LEDs             int    // What the LED count report says.
+	Release          uint16 // The USB device version, which tells the newer variants apart.
+	ProductName      string
+	ManufacturerName string
+
+	mu        sync.Mutex
+	transfers []Transfer
+	reports   map[uint16][]byte
+	err       error
+	closed    bool
+	gate      chan struct{} // Closed by Unblock; transfers wait on it while it's set.
+	waiting   int
+}
+
+// New returns a fake BlinkStick Strip with 8 LEDs. Give it a serial ending in 3.0 to
+// match; any of the fields can be changed before use.
+func New() *Device {
+	return &Device{
+		LEDs:             8,
+		Release:          0x0201,
+		ProductName:      "BlinkStick",
+		ManufacturerName: "Agile Innovative Ltd",
+		reports:          map[uint16][]byte{},
+	}
+}
+
+// Control records the transfer and answers it.
+func (d *Device) Control(requestType, request uint8, val, idx uint16, data []byte) (int, error) {
+	d.wait()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, ErrClosed
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	n := len(data)
+	switch {
+	case requestType&0x80 == 0:
+		if d.reports == nil {
+			d.reports = map[uint16][]byte{}
+		}
+		d.reports[val] = append([]byte(nil), data...)
+	case request == 0x06:
+		n = 0 // No report descriptor, so the default report IDs get used.
+	default:
+		for i := range data {
+			data[i] = 0
+		}
+		report, ok := d.reports[val]
+		if !ok && val == 0x81 {
+			report = []byte{0x81, byte(d.LEDs)}
+		}
+		copy(data, report)
+	}
+
+	d.transfers = append(d.transfers, Transfer{
+		RequestType: requestType,
+		Request:     request,
+		Value:       val,
+		Index:       idx,
+		Data:        append([]byte(nil), data[:n]...),
+	})
+	return n, nil
+}
+
+// Revision returns the USB device version.
+func (d *Device) Revision() uint16 {
+	return d.Release
+}
+
+// Product returns the product name.
+func (d *Device) Product() (string, error) {
+	return d.ProductName, nil
+}
+
+// Manufacturer returns the manufacturer's name.
+func (d *Device) Manufacturer() (string, error) {
+	return d.ManufacturerName, nil
+}
+
+// Close marks the device closed, after which every transfer fails with ErrClosed.
+func (d *Device) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return nil
+}
+
+// SetError makes every transfer fail with err until it's called again with nil. Failed
+// transfers aren't recorded.
+func (d *Device) SetError(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+}
+
+// Block makes every transfer wait before it's answered until Unblock is called, for
+// testing what happens while one is in flight.
+func (d *Device) Block() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.gate == nil {
+		d.gate = make(chan struct{})
+	}
+}
+
+// Unblock lets every transfer held up by Block go through, and stops holding up new ones.
+func (d *Device) Unblock() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.gate != nil {
+		close(d.gate)
+		d.gate = nil
+	}
+}
+
+// Waiting returns how many transfers are being held up by Block.
+func (d *Device) Waiting() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.waiting
+}
+
+// Holds a transfer up for as long as the device is blocked.
+func (d *Device) wait() {
+	d.mu.Lock()
+	gate := d.gate
+	if gate == nil {
+		d.mu.Unlock()
+		return
+	}
+	d.waiting++
+	d.mu.Unlock()
+
+	<-gate
+
+	d.mu.Lock()
+	d.waiting--
+	d.mu.Unlock()
+}
+
+// Transfers returns every transfer made so far, oldest first.
+func (d *Device) Transfers() []Transfer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Transfer(nil), d.transfers...)
+}
+
+// Writes returns just the transfers that sent data to the device, oldest first.
+func (d *Device) Writes() []Transfer {
+	var writes []Transfer
+	for _, t := range d.Transfers() {
+		if t.IsWrite() {
+			writes = append(writes, t)
+		}
+	}
+	return writes
+}
+
+// Reset forgets the recorded transfers, leaving the reports' contents alone.
+func (d *Device) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.transfers = nil
+}
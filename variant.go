@@ -0,0 +1,154 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * variant.go
+ */
+
+package blinkstickgo
+
+import "fmt"
+
+// Variant identifies which member of the BlinkStick line a device is.
+type Variant int
+
+// The known BlinkStick variants.
+const (
+	VariantUnknown Variant = iota
+	VariantBlinkStick
+	VariantPro
+	VariantSquare
+	VariantStrip
+	VariantNano
+	VariantFlex
+)
+
+// String returns the product name of the variant.
+func (v Variant) String() string {
+	switch v {
+	case VariantBlinkStick:
+		return "BlinkStick"
+	case VariantPro:
+		return "BlinkStick Pro"
+	case VariantSquare:
+		return "BlinkStick Square"
+	case VariantStrip:
+		return "BlinkStick Strip"
+	case VariantNano:
+		return "BlinkStick Nano"
+	case VariantFlex:
+		return "BlinkStick Flex"
+	}
+	return "Unknown"
+}
+
+// GetVariant works out which variant the device is.
+//
+// The major version at the end of the serial (BSnnnnnn-M.m) narrows it down, and the
+// newer sticks, which all share major version 3, are told apart by their device version.
+func (stk *BlinkStick) GetVariant() Variant {
+	if len(stk.Serial) < 3 {
+		return VariantUnknown
+	}
+
+	switch stk.Serial[len(stk.Serial)-3] {
+	case '1':
+		return VariantBlinkStick
+	case '2':
+		return VariantPro
+	case '3':
+		revision, ok := stk.revision()
+		if !ok {
+			return VariantUnknown
+		}
+		switch revision {
+		case 0x0200:
+			return VariantSquare
+		case 0x0201:
+			return VariantStrip
+		case 0x0202:
+			return VariantNano
+		case 0x0203:
+			return VariantFlex
+		}
+	}
+	return VariantUnknown
+}
+
+// ChannelCount returns the number of channels the device can drive.
+//
+// The Pro has three (R, G, and B on the board) and every other variant has one. Set
+// the Channels field to override this for unusual hardware.
+func (stk *BlinkStick) ChannelCount() int {
+	if stk.Channels > 0 {
+		return stk.Channels
+	}
+	if stk.GetVariant() == VariantPro {
+		return 3
+	}
+	return 1
+}
+
+// Guesses whether the device's LEDs take RGB rather than GRB data.
+//
+// The original BlinkStick has a plain RGB LED, as does a Pro in normal or inverse mode.
+// Everything else, including a Pro in WS2812 mode, drives smart pixels which want GRB.
+func (stk *BlinkStick) detectRGB() bool {
+	switch stk.GetVariant() {
+	case VariantBlinkStick:
+		return true
+	case VariantPro:
+		mode, err := stk.GetMode()
+		return err == nil && mode != ModeWS2812
+	}
+	return false
+}
+
+// CalibrateColorOrder works out whether the device takes RGB or GRB data, and sets the RGB
+// field to match.
+//
+// It sets the first LED to pure red through the firmware, which knows the order its LEDs
+// want, and then reads the raw LED data back to see where the red ended up. This needs a
+// device that can read back its LED data, which rules out the original BlinkStick.
+// The Pro only gives back the color as it was sent. Both get ErrUnsupported. The LED is
+// turned off again afterwards, even if calibrating fails.
+func (stk *BlinkStick) CalibrateColorOrder() (err error) {
+	switch stk.GetVariant() {
+	case VariantBlinkStick, VariantPro:
+		return ErrUnsupported
+	}
+
+	defer func() {
+		offErr := stk.control(0x20, 0x09, 0x01, 0x00, []byte{0, 0, 0, 0})
+		if err == nil {
+			err = offErr
+		}
+	}()
+
+	err = stk.control(0x20, 0x09, 0x01, 0x00, []byte{0, 255, 0, 0})
+	if err != nil {
+		return err
+	}
+
+	// Straight from the report, skipping GetLEDData's reordering by the current setting.
+	reportID, maxLEDs := stk.getReportID(3)
+	buffer := make([]byte, 2+maxLEDs*3)
+	err = stk.control(0x80|0x20, 0x01, reportID, 0x00, buffer)
+	if err != nil {
+		return err
+	}
+	data := buffer[2:5]
+
+	switch {
+	case data[0] >= 252 && data[1] <= 3:
+		stk.RGB = true
+	case data[1] >= 252 && data[0] <= 3:
+		stk.RGB = false
+	default:
+		return fmt.Errorf("couldn't tell the color order from the LED data %v", data)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * watchdog.go
+ */
+
+package blinkstickgo
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Turns the lights off if nothing has been written to the device for too long.
+type watchdog struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	timer   *time.Timer // Nil while the watchdog is off.
+	last    time.Time   // When the last write went through.
+	tripped bool        // Set once the lights have been turned off, until the next write.
+	enabled int         // Counts calls to EnableWatchdog, so timers it's replaced can tell.
+
+	// The stick that last wrote, or enabled the watchdog, for its inversion, color order,
+	// filter, and so on, so the lights are turned off the way it would turn them off.
+	writer BlinkStick
+}
+
+// EnableWatchdog turns every LED on every channel off if nothing is written to the device
+// for timeout, so a control loop that hangs or crashes doesn't leave a strip stuck on
+// overnight. It starts counting now, and every write starts it over. Calling it again
+// changes the timeout.
+//
+// The lights are turned off with the settings of the last stick to write to the device.
+// Temporal dithering's redraws don't count as writes. Close turns the watchdog off.
+func (stk *BlinkStick) EnableWatchdog(timeout time.Duration) {
+	w := &stk.shared().watchdog
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timeout = timeout
+	w.last = time.Now()
+	w.tripped = false
+	w.writer = *stk
+
+	w.enabled++
+	enabled := w.enabled
+	w.timer = time.AfterFunc(timeout, func() {
+		w.fired(enabled)
+	})
+}
+
+// DisableWatchdog stops the watchdog started by EnableWatchdog, if there is one.
+func (stk *BlinkStick) DisableWatchdog() {
+	w := &stk.shared().watchdog
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// Starts the watchdog's count over, for when stk has written to the device.
+func (w *watchdog) kick(stk *BlinkStick) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer == nil {
+		return
+	}
+
+	w.last = time.Now()
+	w.writer = *stk
+	if w.tripped {
+		w.tripped = false
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// Runs when the watchdog's timer goes off. The lights are only turned off if nothing has
+// been written since the count was last started; otherwise the timer is set again for the
+// rest of the timeout.
+func (w *watchdog) fired(enabled int) {
+	w.mu.Lock()
+	if w.timer == nil || w.enabled != enabled {
+		w.mu.Unlock()
+		return // Disabled or replaced since.
+	}
+	if idle := time.Since(w.last); idle < w.timeout {
+		w.timer.Reset(w.timeout - idle)
+		w.mu.Unlock()
+		return
+	}
+	w.tripped = true
+
+	// The watchdog writes with a copy of its own, so that turning the lights off doesn't
+	// count as a write, and so that it never waits on a transfer that's hung.
+	off := w.writer
+	off.background = true
+	off.noWait = true
+	w.mu.Unlock()
+
+	err := off.OffAllChannels()
+	if errors.Is(err, errBusy) {
+		// Something's still being written, so try again once it's had the full timeout.
+		w.mu.Lock()
+		if w.timer != nil && w.enabled == enabled {
+			w.tripped = false
+			w.last = time.Now()
+			w.timer.Reset(w.timeout)
+		}
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,158 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * xterm.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Xterm256 is xterm's 256 color palette, for matching the lights to a terminal's colors.
+//
+// The first 16 are xterm's defaults for the system colors, which terminal themes tend to
+// change. The rest are a 6x6x6 color cube followed by 24 shades of gray.
+var Xterm256 = [256]Color{
+	// The system colors: black, red, green, yellow, blue, magenta, cyan, and white, then
+	// their bright versions.
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+
+	// The color cube, with blue counting up fastest and red slowest.
+	{0, 0, 0}, {0, 0, 95}, {0, 0, 135}, {0, 0, 175}, {0, 0, 215}, {0, 0, 255},
+	{0, 95, 0}, {0, 95, 95}, {0, 95, 135}, {0, 95, 175}, {0, 95, 215}, {0, 95, 255},
+	{0, 135, 0}, {0, 135, 95}, {0, 135, 135}, {0, 135, 175}, {0, 135, 215}, {0, 135, 255},
+	{0, 175, 0}, {0, 175, 95}, {0, 175, 135}, {0, 175, 175}, {0, 175, 215}, {0, 175, 255},
+	{0, 215, 0}, {0, 215, 95}, {0, 215, 135}, {0, 215, 175}, {0, 215, 215}, {0, 215, 255},
+	{0, 255, 0}, {0, 255, 95}, {0, 255, 135}, {0, 255, 175}, {0, 255, 215}, {0, 255, 255},
+	{95, 0, 0}, {95, 0, 95}, {95, 0, 135}, {95, 0, 175}, {95, 0, 215}, {95, 0, 255},
+	{95, 95, 0}, {95, 95, 95}, {95, 95, 135}, {95, 95, 175}, {95, 95, 215}, {95, 95, 255},
+	{95, 135, 0}, {95, 135, 95}, {95, 135, 135}, {95, 135, 175}, {95, 135, 215}, {95, 135, 255},
+	{95, 175, 0}, {95, 175, 95}, {95, 175, 135}, {95, 175, 175}, {95, 175, 215}, {95, 175, 255},
+	{95, 215, 0}, {95, 215, 95}, {95, 215, 135}, {95, 215, 175}, {95, 215, 215}, {95, 215, 255},
+	{95, 255, 0}, {95, 255, 95}, {95, 255, 135}, {95, 255, 175}, {95, 255, 215}, {95, 255, 255},
+	{135, 0, 0}, {135, 0, 95}, {135, 0, 135}, {135, 0, 175}, {135, 0, 215}, {135, 0, 255},
+	{135, 95, 0}, {135, 95, 95}, {135, 95, 135}, {135, 95, 175}, {135, 95, 215}, {135, 95, 255},
+	{135, 135, 0}, {135, 135, 95}, {135, 135, 135}, {135, 135, 175}, {135, 135, 215}, {135, 135, 255},
+	{135, 175, 0}, {135, 175, 95}, {135, 175, 135}, {135, 175, 175}, {135, 175, 215}, {135, 175, 255},
+	{135, 215, 0}, {135, 215, 95}, {135, 215, 135}, {135, 215, 175}, {135, 215, 215}, {135, 215, 255},
+	{135, 255, 0}, {135, 255, 95}, {135, 255, 135}, {135, 255, 175}, {135, 255, 215}, {135, 255, 255},
+	{175, 0, 0}, {175, 0, 95}, {175, 0, 135}, {175, 0, 175}, {175, 0, 215}, {175, 0, 255},
+	{175, 95, 0}, {175, 95, 95}, {175, 95, 135}, {175, 95, 175}, {175, 95, 215}, {175, 95, 255},
+	{175, 135, 0}, {175, 135, 95}, {175, 135, 135}, {175, 135, 175}, {175, 135, 215}, {175, 135, 255},
+	{175, 175, 0}, {175, 175, 95}, {175, 175, 135}, {175, 175, 175}, {175, 175, 215}, {175, 175, 255},
+	{175, 215, 0}, {175, 215, 95}, {175, 215, 135}, {175, 215, 175}, {175, 215, 215}, {175, 215, 255},
+	{175, 255, 0}, {175, 255, 95}, {175, 255, 135}, {175, 255, 175}, {175, 255, 215}, {175, 255, 255},
+	{215, 0, 0}, {215, 0, 95}, {215, 0, 135}, {215, 0, 175}, {215, 0, 215}, {215, 0, 255},
+	{215, 95, 0}, {215, 95, 95}, {215, 95, 135}, {215, 95, 175}, {215, 95, 215}, {215, 95, 255},
+	{215, 135, 0}, {215, 135, 95}, {215, 135, 135}, {215, 135, 175}, {215, 135, 215}, {215, 135, 255},
+	{215, 175, 0}, {215, 175, 95}, {215, 175, 135}, {215, 175, 175}, {215, 175, 215}, {215, 175, 255},
+	{215, 215, 0}, {215, 215, 95}, {215, 215, 135}, {215, 215, 175}, {215, 215, 215}, {215, 215, 255},
+	{215, 255, 0}, {215, 255, 95}, {215, 255, 135}, {215, 255, 175}, {215, 255, 215}, {215, 255, 255},
+	{255, 0, 0}, {255, 0, 95}, {255, 0, 135}, {255, 0, 175}, {255, 0, 215}, {255, 0, 255},
+	{255, 95, 0}, {255, 95, 95}, {255, 95, 135}, {255, 95, 175}, {255, 95, 215}, {255, 95, 255},
+	{255, 135, 0}, {255, 135, 95}, {255, 135, 135}, {255, 135, 175}, {255, 135, 215}, {255, 135, 255},
+	{255, 175, 0}, {255, 175, 95}, {255, 175, 135}, {255, 175, 175}, {255, 175, 215}, {255, 175, 255},
+	{255, 215, 0}, {255, 215, 95}, {255, 215, 135}, {255, 215, 175}, {255, 215, 215}, {255, 215, 255},
+	{255, 255, 0}, {255, 255, 95}, {255, 255, 135}, {255, 255, 175}, {255, 255, 215}, {255, 255, 255},
+
+	// The grayscale ramp, from near black to near white.
+	{8, 8, 8}, {18, 18, 18}, {28, 28, 28}, {38, 38, 38}, {48, 48, 48}, {58, 58, 58},
+	{68, 68, 68}, {78, 78, 78}, {88, 88, 88}, {98, 98, 98}, {108, 108, 108}, {118, 118, 118},
+	{128, 128, 128}, {138, 138, 138}, {148, 148, 148}, {158, 158, 158}, {168, 168, 168}, {178, 178, 178},
+	{188, 188, 188}, {198, 198, 198}, {208, 208, 208}, {218, 218, 218}, {228, 228, 228}, {238, 238, 238},
+}
+
+// Set256 sets one LED to a color from the xterm 256 color palette.
+func (stk *BlinkStick) Set256(channel, index byte, colorIndex uint8) error {
+	c := Xterm256[colorIndex]
+	return stk.SetRGB(channel, index, c.R, c.G, c.B)
+}
+
+// ParseANSIColor returns the color an ANSI SGR escape sequence sets, like
+// "\x1b[38;2;255;128;0m" for 24-bit color, "\x1b[38;5;208m" for the 256 color palette, or
+// "\x1b[91m" for one of the 16 system colors. The escape and the final "m" can be left off.
+//
+// Background colors are understood too, though if the sequence sets both, the foreground
+// wins. Other attributes, like bold, are skipped over. Palette colors come from Xterm256.
+func ParseANSIColor(code string) (Color, error) {
+	params := strings.TrimPrefix(code, "\x1b[")
+	if len(params) < len(code) && !strings.HasSuffix(params, "m") {
+		return Color{}, fmt.Errorf("ANSI sequence %q isn't an SGR sequence", code)
+	}
+	params = strings.TrimSuffix(params, "m")
+
+	var values []int
+	for _, param := range strings.Split(params, ";") {
+		v, err := strconv.Atoi(param)
+		if err != nil || v < 0 {
+			return Color{}, fmt.Errorf("ANSI sequence %q has a bad parameter %q", code, param)
+		}
+		values = append(values, v)
+	}
+
+	var fg, bg *Color
+	for i := 0; i < len(values); i++ {
+		var c Color
+		v := values[i]
+		switch {
+		case v == 38 || v == 48:
+			extended, n, err := extendedColor(values[i+1:])
+			if err != nil {
+				return Color{}, fmt.Errorf("ANSI sequence %q: %w", code, err)
+			}
+			c = extended
+			i += n
+		case v >= 30 && v <= 37, v >= 40 && v <= 47:
+			c = Xterm256[v%10]
+		case v >= 90 && v <= 97, v >= 100 && v <= 107:
+			c = Xterm256[8+v%10]
+		default:
+			continue
+		}
+
+		if v/10%2 == 1 { // 3x, 9x, and 38 are foreground colors; the rest are background.
+			fg = &c
+		} else {
+			bg = &c
+		}
+	}
+
+	switch {
+	case fg != nil:
+		return *fg, nil
+	case bg != nil:
+		return *bg, nil
+	}
+	return Color{}, fmt.Errorf("ANSI sequence %q doesn't set a color", code)
+}
+
+// Reads the parameters of an extended color, 5 and a palette index or 2 and the red,
+// green, and blue, returning the color and how many parameters it took up.
+func extendedColor(values []int) (Color, int, error) {
+	switch {
+	case len(values) >= 2 && values[0] == 5:
+		if values[1] > 255 {
+			return Color{}, 0, fmt.Errorf("palette index %d is past 255", values[1])
+		}
+		return Xterm256[values[1]], 2, nil
+	case len(values) >= 4 && values[0] == 2:
+		for _, v := range values[1:4] {
+			if v > 255 {
+				return Color{}, 0, fmt.Errorf("color component %d is past 255", v)
+			}
+		}
+		return Color{byte(values[1]), byte(values[2]), byte(values[3])}, 4, nil
+	}
+	return Color{}, 0, fmt.Errorf("extended color is missing its parameters")
+}
@@ -0,0 +1,78 @@
+/* 
+ * BlinkStickGo - A libusb-based go package for controlling the BlinkStick line of products.
+ * 
+ *   This Source Code Form is subject to the terms of the Mozilla Public
+ *   License, v. 2.0. If a copy of the MPL was not distributed with this
+ *   file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ *
+ * zone.go
+ */
+
+package blinkstickgo
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The named zones defined on a strip.
+type zoneTable struct {
+	mu    sync.Mutex
+	zones map[string]zone
+}
+
+// A run of LEDs, from start up to, but not including, end.
+type zone struct {
+	start, end int
+}
+
+// DefineZone names a run of LEDs on the strip, from start up to, but not including, end,
+// so it can be set with ZoneSetAll without any index arithmetic. Zones are shared by
+// every copy of the BlinkStick.
+//
+// Zones can't overlap or run past the end of the strip. Defining a zone again with the
+// same name moves it.
+func (stk *BlinkStick) DefineZone(name string, start, end int) error {
+	if start < 0 || end <= start {
+		return fmt.Errorf("zone %q has an empty or negative range %d to %d", name, start, end)
+	}
+	if count := stk.GetLEDCount(); count >= 0 && end > count {
+		return fmt.Errorf("zone %q ends at %d, but the device only has %d LEDs", name, end, count)
+	}
+
+	table := &stk.shared().zones
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	for other, z := range table.zones {
+		if other != name && start < z.end && z.start < end {
+			return fmt.Errorf("zone %q overlaps zone %q", name, other)
+		}
+	}
+	if table.zones == nil {
+		table.zones = map[string]zone{}
+	}
+	table.zones[name] = zone{start, end}
+	return nil
+}
+
+// ZoneSetAll sets every LED in a zone to one color, on the default channel, leaving the
+// rest of the strip as it is.
+func (stk *BlinkStick) ZoneSetAll(name string, c Color) error {
+	table := &stk.shared().zones
+	table.mu.Lock()
+	z, ok := table.zones[name]
+	table.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown zone %q", name)
+	}
+
+	frame, err := stk.currentFrame(stk.channel)
+	if err != nil {
+		return err
+	}
+	if len(frame.Pixels) < z.end {
+		frame.Pixels = append(frame.Pixels, make([]Color, z.end-len(frame.Pixels))...)
+	}
+	frame.FillRange(z.start, z.end, c)
+	return stk.Flush(stk.channel, frame)
+}